@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+func archiveCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "archive",
+		Short: "Manage archive of built packages",
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "ls",
+			Short: "List archived package versions",
+			Args:  cobra.NoArgs,
+			RunE:  runArchiveList,
+		},
+	)
+
+	return cmd
+}
+
+func runArchiveList(cmd *cobra.Command, args []string) error {
+	archive, err := archiveDir()
+	if err != nil {
+		return err
+	}
+
+	// $ARCHIVE/$TARGET/$SOURCE/$VERSION
+	dirs, err := filepath.Glob(filepath.Join(archive, "*", "*", "*"))
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			continue
+		}
+
+		rel, err := filepath.Rel(archive, dir)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(rel)
+	}
+
+	return nil
+}
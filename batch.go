@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"github.com/dawidd6/deber/pkg/batch"
+	"github.com/dawidd6/deber/pkg/log"
+	"github.com/dawidd6/deber/pkg/report"
+	"github.com/spf13/cobra"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// batchBuild creates process building single package of batch
+var batchBuild = exec.Command
+
+func batchCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "batch DIR...",
+		Short: "Build packages in given directories in order of their build dependencies",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runBatch,
+	}
+}
+
+// runBatch builds packages in given directories one by one,
+// in order of their build dependencies.
+//
+// Every build is a separate process of this program building package
+// in its directory, so its own debian/deber.conf is applied. Reports of builds,
+// if requested, are collected into one batch report.
+func runBatch(cmd *cobra.Command, args []string) error {
+	err := setOutput()
+	if err != nil {
+		return err
+	}
+
+	sources := make([]*batch.Source, 0)
+	for _, dir := range args {
+		source, err := batch.Load(dir)
+		if err != nil {
+			return err
+		}
+
+		sources = append(sources, source)
+	}
+
+	sorted, err := batch.Sort(sources)
+	if err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(*buildDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	reportDir, err := ioutil.TempDir(*buildDir, Program+"-batch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(reportDir)
+
+	// Flags from config of current directory are not passed,
+	// builds load configs of their own
+	flags := flagArgs(os.Args[1:], cmd.Flags(), "report", "output")
+	batchReport := report.NewBatch()
+
+	// Every build archives its packages, so next ones can use them
+	for i, source := range sorted {
+		log.Info(fmt.Sprintf("Building %s (%d/%d)", source.Name, i+1, len(sorted)))
+		log.Drop()
+
+		reportFile := filepath.Join(reportDir, source.Name+".json")
+		start := time.Now()
+
+		child := batchBuild(executable, append([]string{"build", source.Dir, "--report", reportFile}, flags...)...)
+		child.Stdout = logOutput()
+		child.Stderr = os.Stderr
+
+		err = child.Run()
+
+		batchReport.Add(readReport(reportFile, source.Name, time.Since(start), err))
+
+		if err != nil {
+			err = fmt.Errorf("%s: %s", source.Name, err)
+			break
+		}
+	}
+
+	reportErr := writeBatchReport(batchReport)
+	if err != nil {
+		return err
+	}
+
+	return reportErr
+}
+
+// logOutput returns where log of this program is printed.
+func logOutput() io.Writer {
+	if *output == outputJSON {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+// readReport reads report written by build of source,
+// making up a failed one if build didn't get to write it.
+func readReport(path, source string, duration time.Duration, err error) *report.Report {
+	rep, readErr := report.ReadFile(path)
+	if readErr == nil {
+		return rep
+	}
+
+	if err == nil {
+		err = readErr
+	}
+
+	return report.NewFailed(source, "build", duration, err)
+}
+
+// writeBatchReport writes report of all builds to file
+// and/or standard output if requested.
+func writeBatchReport(batchReport *report.Batch) error {
+	if *reportFile != "" {
+		err := batchReport.WriteFile(*reportFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *output == outputJSON {
+		return batchReport.Write(os.Stdout)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/dawidd6/deber/pkg/log"
+	"github.com/dawidd6/deber/pkg/report"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Every fake build writes report with name of directory it was given
+const fakeBatchBuild = `
+[ "$1" = build ] && [ "$3" = --report ] || exit 1
+printf '{"source": "%s", "status": "success"}' $(basename "$2") > "$4"
+`
+
+func TestBatchReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deber")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	controls := map[string]string{
+		"app":    "Source: app\nBuild-Depends: libfoo-dev\n\nPackage: app\n",
+		"libfoo": "Source: libfoo\n\nPackage: libfoo-dev\n",
+	}
+
+	for name, control := range controls {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, name, "debian"), os.ModePerm))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name, "debian", "control"), []byte(control), 0644))
+	}
+
+	buffer := new(bytes.Buffer)
+	log.SetDefault(log.New(buffer, log.Options{Prefix: Program, Level: log.LevelNormal}))
+	defer log.SetDefault(log.New(os.Stdout, log.Options{Prefix: Program, Level: log.LevelNormal}))
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{Program}
+
+	batchBuild = func(name string, args ...string) *exec.Cmd {
+		return exec.Command("sh", append([]string{"-c", fakeBatchBuild, "sh"}, args...)...)
+	}
+	defer func() { batchBuild = exec.Command }()
+
+	*buildDir = dir
+	*reportFile = filepath.Join(dir, "batch.json")
+	defer func() { *reportFile = "" }()
+
+	cmd := batchCommand()
+	err = runBatch(cmd, []string{filepath.Join(dir, "app"), filepath.Join(dir, "libfoo")})
+	assert.NoError(t, err, buffer.String())
+
+	data, err := ioutil.ReadFile(*reportFile)
+	assert.NoError(t, err)
+
+	batchReport := new(report.Batch)
+	assert.NoError(t, json.Unmarshal(data, batchReport))
+	assert.Equal(t, report.StatusSuccess, batchReport.Status)
+	assert.Len(t, batchReport.Reports, 2)
+	assert.Equal(t, "libfoo", batchReport.Reports[0].Source)
+	assert.Equal(t, "app", batchReport.Reports[1].Source)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"github.com/dawidd6/deber/pkg/docker"
+	"github.com/dawidd6/deber/pkg/lock"
+	"github.com/dawidd6/deber/pkg/log"
+	"github.com/dawidd6/deber/pkg/naming"
+	"github.com/dawidd6/deber/pkg/report"
+	"github.com/dawidd6/deber/pkg/steps"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+func buildCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "build [DIR]",
+		Short: "Build package in given or current directory (default)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runBuild,
+	}
+}
+
+func runBuild(cmd *cobra.Command, args []string) error {
+	if *shell {
+		return runShell(cmd, args)
+	}
+
+	if len(*matrix) > 0 {
+		return runMatrix(cmd.Flags(), sourceDir(args))
+	}
+
+	err := setOutput()
+	if err != nil {
+		return err
+	}
+
+	return build(sourceDir(args))
+}
+
+// sourceDir returns package directory given in arguments,
+// current directory by default.
+func sourceDir(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+
+	return "."
+}
+
+// setOutput redirects log to standard error if
+// standard output is reserved for report.
+func setOutput() error {
+	switch *output {
+	case outputText:
+	case outputJSON:
+		// Keep standard output clean for the report
+		logger.SetOutput(os.Stderr)
+	default:
+		return fmt.Errorf("unknown output format: %s", *output)
+	}
+
+	return nil
+}
+
+// build runs the whole pipeline for package in given directory.
+//
+// Log of the build is left open, so error failing it
+// gets written there too, it's closed by main.
+func build(dir string) error {
+	start := time.Now()
+
+	dock, n, err := setup(dir)
+	if err != nil {
+		// Name of source may be unknown, directory has to do
+		source, _ := filepath.Abs(dir)
+		rep := report.NewFailed(filepath.Base(source), "setup", time.Since(start), err)
+
+		reportErr := emitReport(rep)
+		if reportErr != nil {
+			log.Debug("couldn't write report: " + reportErr.Error())
+		}
+
+		return err
+	}
+
+	// Other process may be using the same container
+	containerLock, err := lock.Acquire(n.ContainerLock)
+	if err != nil {
+		return err
+	}
+	defer containerLock.Release()
+
+	err = logger.Tee(n.LogFile)
+	if err != nil {
+		return err
+	}
+
+	pipeline := []steps.Step{
+		{
+			Name: "build",
+			Run:  func() error { return steps.Build(dock, n, buildArgs()) },
+		}, {
+			Name: "create",
+			Run:  func() error { return steps.Create(dock, n, *packages, *aptProxy) },
+		}, {
+			Name: "start",
+			Run:  func() error { return steps.Start(dock, n) },
+		}, {
+			Name: "tarball",
+			Run:  func() error { return steps.Tarball(n) },
+		}, {
+			Name: "depends",
+			Run:  func() error { return steps.Depends(dock, n, *packages, *aptProxy) },
+		}, {
+			Name: "package",
+			Run:  func() error { return steps.Package(dock, n, mode, *dpkgFlags, *network) },
+		}, {
+			Name: "test",
+			Run: func() error {
+				return steps.Test(dock, n, steps.TestArgs{
+					LintianFlags:  *lintianFlags,
+					NoLintian:     *noLintian,
+					NoAutopkgtest: *noAutopkgtest,
+					FailOn:        *failOn,
+					AptProxy:      *aptProxy,
+					Mode:          mode,
+				})
+			},
+		}, {
+			Name: "install",
+			Run: func() error {
+				return steps.Install(dock, n, steps.InstallArgs{
+					Enabled:       *installTest,
+					Customization: customization,
+					AptProxy:      *aptProxy,
+					Mode:          mode,
+				})
+			},
+		}, {
+			Name: "archive",
+			Run:  func() error { return steps.Archive(n, mode) },
+		}, {
+			Name: "sign",
+			Run:  func() error { return steps.Sign(n, mode, *signKey, os.Getenv(SignPassphraseEnv)) },
+		}, {
+			Name: "stop",
+			Run:  func() error { return steps.Stop(dock, n) },
+		}, {
+			Name: "remove",
+			Run:  func() error { return steps.Remove(dock, n) },
+		},
+	}
+
+	skipped := *skip
+	if *noRemove {
+		skipped = append(skipped, "remove")
+	}
+
+	selected, err := steps.Select(pipeline, *only, skipped, *from, *until)
+	if err != nil {
+		return err
+	}
+
+	rep := report.New(n)
+	err = runSteps(pipeline, selected, rep)
+
+	reportErr := writeReport(dock, rep, n)
+	if err != nil {
+		return err
+	}
+
+	return reportErr
+}
+
+// writeReport writes build report to file and/or standard output
+// if requested.
+func writeReport(dock *docker.Docker, rep *report.Report, n *naming.Naming) error {
+	if *reportFile == "" && *output != outputJSON {
+		return nil
+	}
+
+	// Image may not be built at all
+	labels, err := dock.ImageLabels(n.Image)
+	if err == nil {
+		rep.SetParent(labels)
+	}
+
+	err = rep.AddFiles(n.ArchiveVersionDir)
+	if err != nil {
+		return err
+	}
+
+	err = rep.AddLintian(n.LintianFile)
+	if err != nil {
+		return err
+	}
+
+	return emitReport(rep)
+}
+
+// emitReport writes given report to file
+// and/or standard output if requested.
+func emitReport(rep *report.Report) error {
+	if *reportFile != "" {
+		err := rep.WriteFile(*reportFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *output == outputJSON {
+		return rep.Write(os.Stdout)
+	}
+
+	return nil
+}
+
+// runSteps runs selected steps of pipeline until one of them fails,
+// recording results in report.
+//
+// Steps not selected or following failed one are recorded as skipped,
+// so the whole pipeline is visible in report.
+func runSteps(pipeline, selected []steps.Step, rep *report.Report) error {
+	run := make(map[string]bool)
+	for _, step := range selected {
+		run[step.Name] = true
+	}
+
+	var err error
+
+	for _, step := range pipeline {
+		if !run[step.Name] || err != nil {
+			rep.AddStep(step.Name, log.StatusSkipped, 0, nil)
+			continue
+		}
+
+		start := time.Now()
+		err = step.Run()
+		rep.AddStep(step.Name, stepStatus(err), time.Since(start), err)
+	}
+
+	return err
+}
+
+// stepStatus returns status of step that has just finished with given error.
+//
+// Steps may return error without printing failed status,
+// but those skipped always print it.
+func stepStatus(err error) string {
+	if err != nil {
+		return log.StatusFailed
+	}
+
+	if log.Status() == log.StatusSkipped {
+		return log.StatusSkipped
+	}
+
+	return log.StatusDone
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/dawidd6/deber/pkg/log"
+	"github.com/dawidd6/deber/pkg/report"
+	"github.com/dawidd6/deber/pkg/steps"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildSetupFailureReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deber")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// No debian/changelog, so setup fails
+	sourceDir := filepath.Join(dir, "pkg")
+	assert.NoError(t, os.Mkdir(sourceDir, os.ModePerm))
+
+	*reportFile = filepath.Join(dir, "report.json")
+	defer func() { *reportFile = "" }()
+
+	err = build(sourceDir)
+	assert.Error(t, err)
+
+	rep, err := report.ReadFile(*reportFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "pkg", rep.Source)
+	assert.Equal(t, report.StatusFailure, rep.Status)
+	assert.Len(t, rep.Steps, 1)
+	assert.Equal(t, "setup", rep.Steps[0].Name)
+	assert.Equal(t, log.StatusFailed, rep.Steps[0].Status)
+}
+
+func TestStepStatus(t *testing.T) {
+	log.SetDefault(log.New(new(bytes.Buffer), log.Options{Prefix: Program, Level: log.LevelNormal}))
+	defer log.SetDefault(log.New(os.Stdout, log.Options{Prefix: Program, Level: log.LevelNormal}))
+
+	log.Info("Skipping")
+	assert.Equal(t, log.StatusSkipped, stepStatus(log.Skipped()))
+
+	// Status of previous step is not inherited
+	log.Info("Failing without status")
+	assert.Equal(t, log.StatusFailed, stepStatus(errors.New("failure")))
+
+	log.Info("Finishing without status")
+	assert.Equal(t, log.StatusDone, stepStatus(nil))
+}
+
+func TestRunSteps(t *testing.T) {
+	log.SetDefault(log.New(new(bytes.Buffer), log.Options{Prefix: Program, Level: log.LevelNormal}))
+	defer log.SetDefault(log.New(os.Stdout, log.Options{Prefix: Program, Level: log.LevelNormal}))
+
+	pipeline := []steps.Step{
+		{Name: "build", Run: func() error { log.Info("Building"); return log.Done() }},
+		{Name: "create", Run: func() error { log.Info("Creating"); return log.Skipped() }},
+		{Name: "start", Run: func() error { log.Info("Starting"); return errors.New("failure") }},
+		{Name: "tarball", Run: func() error { t.Fatal("step after failed one was run"); return nil }},
+	}
+
+	rep := &report.Report{Status: report.StatusSuccess}
+	err := runSteps(pipeline, pipeline[1:], rep)
+	assert.Error(t, err)
+
+	statuses := make([]string, 0)
+	for _, step := range rep.Steps {
+		statuses = append(statuses, step.Name+" "+step.Status)
+	}
+
+	assert.Equal(t, []string{
+		"build skipped",
+		"create skipped",
+		"start failed",
+		"tarball skipped",
+	}, statuses)
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"github.com/dawidd6/deber/pkg/docker"
+	"github.com/dawidd6/deber/pkg/lock"
+	"github.com/dawidd6/deber/pkg/log"
+	"github.com/dawidd6/deber/pkg/naming"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	cleanTarget    string
+	cleanSource    string
+	cleanOlderThan time.Duration
+	cleanDryRun    bool
+)
+
+func cleanCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove containers, images, build and cache directories made by " + Program,
+		Args:  cobra.NoArgs,
+		RunE:  runClean,
+	}
+
+	cmd.Flags().StringVarP(&cleanTarget, "target", "t", "", "remove only stuff of given target distribution (with architecture and customization hash if any)")
+	cmd.Flags().StringVarP(&cleanSource, "source", "S", "", "remove only stuff of given source package, keeps images and cache")
+	cmd.Flags().DurationVarP(&cleanOlderThan, "older-than", "O", 0, "remove only stuff older than given duration")
+	cmd.Flags().BoolVarP(&cleanDryRun, "dry-run", "N", false, "only show what would be removed")
+
+	return cmd
+}
+
+// cleanMatch checks if stuff of given tag, source and age should be removed.
+//
+// Images and cache directories don't belong to any source.
+func cleanMatch(tag, source string, age time.Duration) bool {
+	if cleanTarget != "" && cleanTarget != tag {
+		return false
+	}
+
+	if cleanSource != "" && cleanSource != source {
+		return false
+	}
+
+	return age >= cleanOlderThan
+}
+
+// cleanDirs returns directories in given base directory matching pattern.
+func cleanDirs(baseDir, pattern string) ([]os.FileInfo, error) {
+	dirs := make([]os.FileInfo, 0)
+
+	paths, err := filepath.Glob(filepath.Join(baseDir, pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			continue
+		}
+
+		dirs = append(dirs, info)
+	}
+
+	return dirs, nil
+}
+
+// cleanLocks returns lock files in given base directory matching pattern.
+func cleanLocks(baseDir, pattern string) ([]os.FileInfo, error) {
+	locks := make([]os.FileInfo, 0)
+
+	paths, err := filepath.Glob(filepath.Join(baseDir, pattern+".lock"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		locks = append(locks, info)
+	}
+
+	return locks, nil
+}
+
+// cleanItem removes single item with given description,
+// unless in dry run mode.
+//
+// Failure is printed and doesn't stop removal of other items,
+// true is returned if item couldn't be removed.
+func cleanItem(description string, remove func() error) bool {
+	log.Info("Removing " + description)
+
+	if cleanDryRun {
+		_ = log.Skipped()
+		return false
+	}
+
+	err := remove()
+	if err != nil {
+		log.Error(log.Failed(err))
+		return true
+	}
+
+	_ = log.Done()
+	return false
+}
+
+// removeDir removes directory along with lock file guarding it,
+// holding the lock meanwhile, so no build starts using it.
+func removeDir(path string) error {
+	dirLock, err := lock.TryAcquire(path + ".lock")
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(path)
+	if err != nil {
+		dirLock.Release()
+		return err
+	}
+
+	return dirLock.Remove()
+}
+
+// removeLock removes lock file, unless lock is held.
+func removeLock(path string) error {
+	held, err := lock.TryAcquire(path)
+	if err != nil {
+		return err
+	}
+
+	return held.Remove()
+}
+
+func runClean(cmd *cobra.Command, args []string) error {
+	dock, err := docker.New()
+	if err != nil {
+		return err
+	}
+
+	failures := 0
+
+	containers, err := dock.ContainerList(Program + "_")
+	if err != nil {
+		return err
+	}
+
+	for _, container := range containers {
+		tag, source, _, err := naming.ParseContainer(Program, container)
+		if err != nil {
+			continue
+		}
+
+		age, err := dock.ContainerAge(container)
+		if err != nil {
+			log.Error(err)
+			failures++
+			continue
+		}
+
+		if !cleanMatch(tag, source, age) {
+			continue
+		}
+
+		// Containers of running build are locked, including installation one
+		lockPath := filepath.Join(*buildDir, strings.TrimSuffix(container, "-install")+".lock")
+
+		if cleanItem("container "+container, func() error {
+			containerLock, err := lock.TryAcquire(lockPath)
+			if err != nil {
+				return err
+			}
+			defer containerLock.Release()
+
+			err = dock.ContainerStop(container)
+			if err != nil {
+				return err
+			}
+
+			return dock.ContainerRemove(container)
+		}) {
+			failures++
+		}
+	}
+
+	buildDirs, err := cleanDirs(*buildDir, Program+"_*")
+	if err != nil {
+		return err
+	}
+
+	for _, info := range buildDirs {
+		dir := info.Name()
+		age := time.Since(info.ModTime())
+
+		tag, source, _, err := naming.ParseContainer(Program, dir)
+		if err != nil {
+			continue
+		}
+
+		if !cleanMatch(tag, source, age) {
+			continue
+		}
+
+		if cleanItem("build directory "+dir, func() error {
+			return removeDir(filepath.Join(*buildDir, dir))
+		}) {
+			failures++
+		}
+	}
+
+	// Images, cache and archive are shared by all sources
+	if cleanSource == "" {
+		failures += cleanShared(dock)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("couldn't remove %d item(s)", failures)
+	}
+
+	return nil
+}
+
+// cleanShared removes images, cache directories and archive locks,
+// returning number of items that couldn't be removed.
+func cleanShared(dock *docker.Docker) int {
+	failures := 0
+
+	images, err := dock.ImageList(Program + ":")
+	if err != nil {
+		log.Error(err)
+		failures++
+	}
+
+	for _, image := range images {
+		tag, err := naming.ParseImage(Program, image)
+		if err != nil {
+			continue
+		}
+
+		age, err := dock.ImageAge(image)
+		if err != nil {
+			log.Error(err)
+			failures++
+			continue
+		}
+
+		if !cleanMatch(tag, "", age) {
+			continue
+		}
+
+		// Image may be in use by container of other program
+		if cleanItem("image "+image, func() error {
+			return dock.ImageRemove(image)
+		}) {
+			failures++
+		}
+	}
+
+	cacheDirs, err := cleanDirs(*cacheDir, Program+":*")
+	if err != nil {
+		log.Error(err)
+		failures++
+	}
+
+	for _, info := range cacheDirs {
+		dir := info.Name()
+		age := time.Since(info.ModTime())
+
+		tag, err := naming.ParseImage(Program, dir)
+		if err != nil {
+			continue
+		}
+
+		if !cleanMatch(tag, "", age) {
+			continue
+		}
+
+		if cleanItem("cache directory "+dir, func() error {
+			return removeDir(filepath.Join(*cacheDir, dir))
+		}) {
+			failures++
+		}
+	}
+
+	archive, err := archiveDir()
+	if err != nil {
+		log.Error(err)
+		return failures + 1
+	}
+
+	// Archived packages are kept, only locks guarding them are removed
+	archiveLocks, err := cleanLocks(archive, "*")
+	if err != nil {
+		log.Error(err)
+		return failures + 1
+	}
+
+	for _, info := range archiveLocks {
+		name := info.Name()
+		age := time.Since(info.ModTime())
+
+		if !cleanMatch(strings.TrimSuffix(name, ".lock"), "", age) {
+			continue
+		}
+
+		if cleanItem("archive lock "+name, func() error {
+			return removeLock(filepath.Join(archive, name))
+		}) {
+			failures++
+		}
+	}
+
+	return failures
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"github.com/dawidd6/deber/pkg/docker"
+	"github.com/dawidd6/deber/pkg/log"
+	"github.com/dawidd6/deber/pkg/steps"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+func imageCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "image",
+		Short: "Manage images built by " + Program,
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "build",
+			Short: "Build image for package in current directory",
+			Args:  cobra.NoArgs,
+			RunE:  runImageBuild,
+		},
+		&cobra.Command{
+			Use:   "rm IMAGE...",
+			Short: "Remove given images",
+			Args:  cobra.MinimumNArgs(1),
+			RunE:  runImageRemove,
+		},
+		&cobra.Command{
+			Use:   "ls",
+			Short: "List images built by " + Program,
+			Args:  cobra.NoArgs,
+			RunE:  runImageList,
+		},
+	)
+
+	return cmd
+}
+
+func runImageBuild(cmd *cobra.Command, args []string) error {
+	dock, n, err := setup(".")
+	if err != nil {
+		return err
+	}
+
+	return steps.Build(dock, n, buildArgs())
+}
+
+func runImageRemove(cmd *cobra.Command, args []string) error {
+	dock, err := docker.New()
+	if err != nil {
+		return err
+	}
+
+	for _, image := range args {
+		// Allow passing just the tag
+		if !strings.HasPrefix(image, Program+":") {
+			image = Program + ":" + image
+		}
+
+		log.Info("Removing image " + image)
+
+		err = dock.ImageRemove(image)
+		if err != nil {
+			return log.Failed(err)
+		}
+
+		_ = log.Done()
+	}
+
+	return nil
+}
+
+func runImageList(cmd *cobra.Command, args []string) error {
+	dock, err := docker.New()
+	if err != nil {
+		return err
+	}
+
+	images, err := dock.ImageList(Program + ":")
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		fmt.Println(image)
+	}
+
+	return nil
+}
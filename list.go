@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"github.com/dawidd6/deber/pkg/docker"
+	"github.com/spf13/cobra"
+)
+
+func listCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List containers created by " + Program,
+		Args:  cobra.NoArgs,
+		RunE:  runList,
+	}
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	dock, err := docker.New()
+	if err != nil {
+		return err
+	}
+
+	containers, err := dock.ContainerList(Program + "_")
+	if err != nil {
+		return err
+	}
+
+	for _, container := range containers {
+		fmt.Println(container)
+	}
+
+	return nil
+}
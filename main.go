@@ -1,13 +1,20 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"github.com/dawidd6/deber/pkg/config"
+	"github.com/dawidd6/deber/pkg/distro"
 	"github.com/dawidd6/deber/pkg/docker"
+	"github.com/dawidd6/deber/pkg/dockerfile"
+	"github.com/dawidd6/deber/pkg/lintian"
 	"github.com/dawidd6/deber/pkg/log"
 	"github.com/dawidd6/deber/pkg/naming"
+	"github.com/dawidd6/deber/pkg/registry"
 	"github.com/dawidd6/deber/pkg/steps"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"net"
 	"os"
 	"path/filepath"
 	"pault.ag/go/debian/changelog"
@@ -21,31 +28,85 @@ const (
 	Version = "1.1.1"
 	// Description of program
 	Description = "Debian packaging with Docker."
+	// AptProxyNone disables apt proxy detection
+	AptProxyNone = "none"
+	// AptCacherNgPort is the default port of apt-cacher-ng
+	AptCacherNgPort = "3142"
+	// SignPassphraseEnv is the environment variable holding passphrase of signing key
+	SignPassphraseEnv = "DEBER_SIGN_PASSPHRASE"
 )
 
 var (
-	buildDir     = pflag.StringP("build-dir", "B", "/tmp", "where to place build stuff")
-	cacheDir     = pflag.StringP("cache-dir", "C", "/tmp", "where to place cached stuff")
-	distribution = pflag.StringP("distribution", "d", "", "override target distribution")
-	packages     = pflag.StringArrayP("package", "p", nil, "additional packages to be installed in container (either single .deb or a directory)")
-	age          = pflag.DurationP("age", "a", time.Hour*24*14, "time after which image will be refreshed")
-	network      = pflag.BoolP("network", "n", false, "allow network access during package build")
-	shell        = pflag.BoolP("shell", "s", false, "launch interactive shell in container")
-	dpkgFlags    = pflag.StringP("dpkg-flags", "D", "-tc", "additional flags to be passed to dpkg-buildpackage in container")
-	lintianFlags = pflag.StringP("lintian-flags", "L", "-i -I", "additional flags to be passed to lintian in container")
-	noLintian    = pflag.BoolP("no-lintian", "l", false, "don't run lintian in container")
-	noLogColor   = pflag.BoolP("no-log-color", "c", false, "do not colorize log output")
-	noRemove     = pflag.BoolP("no-remove", "r", false, "do not remove container at the end of the process")
+	buildDir      = pflag.StringP("build-dir", "B", "/tmp", "where to place build stuff")
+	cacheDir      = pflag.StringP("cache-dir", "C", "/tmp", "where to place cached stuff")
+	distribution  = pflag.StringP("distribution", "d", "", "override target distribution")
+	matrix        = pflag.StringSliceP("matrix", "M", nil, "build for all given target distributions, in parallel")
+	jobs          = pflag.IntP("jobs", "j", 2, "how many builds of matrix can run at once")
+	arch          = pflag.StringP("arch", "A", "", "build for given architecture under qemu-user emulation (e.g. arm64, armhf)")
+	hostArch      = pflag.StringP("host-arch", "H", "", "cross-compile for given architecture with native toolchain (e.g. arm64, armhf)")
+	packages      = pflag.StringArrayP("package", "p", nil, "additional packages to be installed in container (either single .deb or a directory)")
+	registryHost  = pflag.StringP("registry", "G", registry.DefaultHost, "registry to pull parent images from and query for tags of distributions not known offline")
+	baseImages    = pflag.StringToStringP("base-image", "i", nil, "use given parent image for target distribution (e.g. beowulf=devuan/devuan)")
+	dockerFile    = pflag.StringP("dockerfile", "F", "", "use given Dockerfile template instead of built-in one")
+	extraFile     = pflag.StringP("dockerfile-extra", "E", "", "append given snippet to Dockerfile of image")
+	baseRepos     = pflag.StringSliceP("base-repo", "b", []string{distro.Debian, distro.Ubuntu}, "repositories to query registry for tags of distributions not known offline")
+	age           = pflag.DurationP("age", "a", time.Hour*24*14, "time after which image will be refreshed")
+	rebuild       = pflag.BoolP("rebuild", "U", false, "rebuild image even if it's up to date")
+	noRebuild     = pflag.BoolP("no-rebuild", "K", false, "do not rebuild existing image even if it's outdated")
+	aptProxy      = pflag.StringP("apt-proxy", "P", "", "HTTP proxy for apt in image and container, apt-cacher-ng on host is detected if not set, \"none\" disables it")
+	network       = pflag.BoolP("network", "n", false, "allow network access during package build")
+	shell         = pflag.BoolP("shell", "s", false, "launch interactive shell in container")
+	dpkgFlags     = pflag.StringP("dpkg-flags", "D", "-tc", "additional flags to be passed to dpkg-buildpackage in container")
+	sourceOnly    = pflag.Bool("source-only", false, "build source package only, e.g. for upload to PPA")
+	binaryArch    = pflag.Bool("binary-arch", false, "build architecture dependent binary packages only")
+	binaryIndep   = pflag.Bool("binary-indep", false, "build architecture independent binary packages only")
+	full          = pflag.Bool("full", false, "build source and all binary packages")
+	lintianFlags  = pflag.StringP("lintian-flags", "L", "-i -I", "additional flags to be passed to lintian in container")
+	noLintian     = pflag.BoolP("no-lintian", "l", false, "don't run lintian in container")
+	failOn        = pflag.StringP("fail-on", "w", lintian.FailOnError, "lowest lintian tag severity failing the build, either error, warning (new ones only) or none")
+	noAutopkgtest = pflag.BoolP("no-autopkgtest", "e", false, "don't run autopkgtest in container")
+	installTest   = pflag.BoolP("install-test", "I", false, "test installation, upgrade and purge of packages in fresh container")
+	noLogColor    = pflag.BoolP("no-log-color", "c", false, "do not colorize log output")
+	quiet         = pflag.BoolP("quiet", "q", false, "print only errors")
+	verbose       = pflag.CountP("verbose", "v", "print executed commands (-v) and debug messages (-vv)")
+	timestamps    = pflag.BoolP("timestamps", "T", false, "prefix log messages with time")
+	reportFile    = pflag.StringP("report", "R", "", "write JSON build report to given file")
+	output        = pflag.StringP("output", "x", "text", "output format, either text or json (build report on stdout, logs on stderr)")
+	signKey       = pflag.StringP("sign-key", "g", "", "armored OpenPGP secret key file to sign archived build and repository with")
+	noRemove      = pflag.BoolP("no-remove", "r", false, "do not remove container at the end of the process")
+	only          = pflag.StringSliceP("only", "o", nil, "run only given steps")
+	skip          = pflag.StringSliceP("skip", "k", nil, "skip given steps")
+	from          = pflag.StringP("from", "f", "", "start from given step")
+	until         = pflag.StringP("until", "u", "", "stop after given step")
+)
+
+var (
+	logger        *log.Log
+	resolver      *distro.Resolver
+	customization dockerfile.Customization
+	mode          string
 )
 
 func main() {
 	cmd := &cobra.Command{
-		Use:     fmt.Sprintf("%s [FLAGS ...]", Program),
-		Short:   Description,
-		Version: Version,
-		RunE:    run,
+		Use:               fmt.Sprintf("%s [FLAGS ...] [DIR]", Program),
+		Args:              cobra.MaximumNArgs(1),
+		Short:             Description,
+		Version:           Version,
+		PersistentPreRunE: preRun,
+		RunE:              runBuild,
 	}
 
+	cmd.AddCommand(
+		buildCommand(),
+		batchCommand(),
+		shellCommand(),
+		listCommand(),
+		cleanCommand(),
+		imageCommand(),
+		archiveCommand(),
+	)
+
 	cmd.SetHelpCommand(&cobra.Command{Hidden: true})
 	cmd.DisableFlagsInUseLine = true
 	cmd.SilenceUsage = true
@@ -54,103 +115,234 @@ func main() {
 	err := cmd.Execute()
 	if err != nil {
 		log.Error(err)
+	}
+
+	// Log file is closed only after error got there
+	if logger != nil {
+		logger.Close()
+	}
+
+	if err != nil {
 		os.Exit(1)
 	}
 }
 
-func run(cmd *cobra.Command, args []string) error {
-	log.NoColor = *noLogColor
+func preRun(cmd *cobra.Command, args []string) error {
+	// Only build is given package directory, other commands work on current one
+	dir := "."
+	if cmd.Name() == "build" || !cmd.HasParent() {
+		dir = sourceDir(args)
+	}
 
-	dock, err := docker.New()
+	err := config.Load(Program, dir, cmd.Flags(), allFlags(cmd.Root()))
 	if err != nil {
 		return err
 	}
 
-	cwd, err := os.Getwd()
+	level := log.LevelNormal + log.Level(*verbose)
+	if level > log.LevelDebug {
+		level = log.LevelDebug
+	}
+	if *quiet {
+		level = log.LevelQuiet
+	}
+
+	logger = log.New(os.Stdout, log.Options{
+		Prefix:     Program,
+		Level:      level,
+		NoColor:    *noLogColor,
+		Timestamps: *timestamps,
+	})
+	log.SetDefault(logger)
+
+	configDir, err := os.UserConfigDir()
 	if err != nil {
 		return err
 	}
 
-	home, err := os.UserHomeDir()
+	userDistributions, err := distro.ParseFile(filepath.Join(configDir, Program, "distributions"))
 	if err != nil {
 		return err
 	}
 
-	path := filepath.Join(cwd, "debian/changelog")
-	ch, err := changelog.ParseFileOne(path)
+	client, err := registry.New(*registryHost)
 	if err != nil {
 		return err
 	}
 
-	if *distribution == "" {
-		*distribution = ch.Target
+	resolver = &distro.Resolver{
+		Images:   *baseImages,
+		Table:    distro.Default(),
+		Repos:    *baseRepos,
+		Registry: client,
 	}
+	resolver.Table.Merge(userDistributions)
 
-	namingArgs := naming.Args{
-		Prefix:         Program,
-		Source:         ch.Source,
-		Version:        ch.Version.String(),
-		Upstream:       ch.Version.Version,
-		Target:         *distribution,
-		SourceBaseDir:  cwd,
-		BuildBaseDir:   *buildDir,
-		CacheBaseDir:   *cacheDir,
-		ArchiveBaseDir: filepath.Join(home, Program),
-	}
-	n := naming.New(namingArgs)
-
-	err = steps.Build(dock, n, *age)
+	customization, err = dockerfile.Load(*dockerFile, *extraFile)
 	if err != nil {
 		return err
 	}
 
-	err = steps.Create(dock, n, *packages)
-	if err != nil {
-		return err
+	if *rebuild && *noRebuild {
+		return errors.New("--rebuild and --no-rebuild can't be used together")
 	}
 
-	err = steps.Start(dock, n)
+	if *installTest && customization.Template != "" {
+		return errors.New("--install-test can't be used with --dockerfile")
+	}
+
+	mode, err = buildMode()
 	if err != nil {
 		return err
 	}
 
-	if *shell {
-		return steps.ShellOptional(dock, n)
+	return lintian.ValidateFailOn(*failOn)
+}
+
+// allFlags returns flags of given command and all its subcommands,
+// so config keys of every command can be recognized.
+func allFlags(cmd *cobra.Command) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(cmd.Name(), pflag.ContinueOnError)
+	flags.AddFlagSet(pflag.CommandLine)
+	flags.AddFlagSet(cmd.PersistentFlags())
+	flags.AddFlagSet(cmd.Flags())
+
+	for _, sub := range cmd.Commands() {
+		flags.AddFlagSet(allFlags(sub))
+	}
+
+	return flags
+}
+
+// buildMode function returns build mode chosen with flags.
+func buildMode() (string, error) {
+	modes := map[string]bool{
+		steps.ModeSource:      *sourceOnly,
+		steps.ModeBinaryArch:  *binaryArch,
+		steps.ModeBinaryIndep: *binaryIndep,
+		steps.ModeFull:        *full,
 	}
 
-	err = steps.Tarball(n)
+	mode := steps.ModeDefault
+
+	for name, chosen := range modes {
+		if !chosen {
+			continue
+		}
+
+		if mode != steps.ModeDefault {
+			return "", errors.New("--source-only, --binary-arch, --binary-indep and --full can't be used together")
+		}
+
+		mode = name
+	}
+
+	return mode, nil
+}
+
+// setup connects to Docker Engine and determines naming
+// of package in given directory.
+func setup(dir string) (*docker.Docker, *naming.Naming, error) {
+	dock, err := docker.New()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	err = steps.Depends(dock, n, *packages)
+	dir, err = filepath.Abs(dir)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	err = steps.Package(dock, n, *dpkgFlags, *network)
+	archive, err := archiveDir()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	err = steps.Test(dock, n, *lintianFlags, *noLintian)
+	path := filepath.Join(dir, "debian/changelog")
+	ch, err := changelog.ParseFileOne(path)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	target := *distribution
+	if target == "" {
+		target = ch.Target
 	}
 
-	err = steps.Archive(n)
+	*aptProxy, err = detectAptProxy(dock)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	namingArgs := naming.Args{
+		Prefix:         Program,
+		Source:         ch.Source,
+		Version:        ch.Version.String(),
+		Upstream:       ch.Version.Version,
+		Target:         target,
+		Arch:           *arch,
+		HostArch:       *hostArch,
+		Customization:  customization.Hash(),
+		SourceBaseDir:  dir,
+		BuildBaseDir:   *buildDir,
+		CacheBaseDir:   *cacheDir,
+		ArchiveBaseDir: archive,
+	}
+
+	return dock, naming.New(namingArgs), nil
+}
+
+// detectAptProxy returns apt proxy to be used in containers.
+//
+// If proxy is not set, apt-cacher-ng listening on host is looked for.
+func detectAptProxy(dock *docker.Docker) (string, error) {
+	if *aptProxy == AptProxyNone {
+		return "", nil
 	}
 
-	err = steps.Stop(dock, n)
+	if *aptProxy != "" {
+		return *aptProxy, nil
+	}
+
+	// Containers reach host via gateway of their network,
+	// so proxy listening on localhost only is of no use
+	gateway, err := dock.NetworkGateway()
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	address := net.JoinHostPort(gateway, AptCacherNgPort)
+
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		return "", nil
+	}
+	conn.Close()
+
+	proxy := "http://" + address
+	log.Debug("detected apt-cacher-ng: " + proxy)
+
+	return proxy, nil
+}
+
+// buildArgs returns arguments of image building step.
+func buildArgs() steps.BuildArgs {
+	return steps.BuildArgs{
+		Resolver:      resolver,
+		Customization: customization,
+		MaxAge:        *age,
+		Rebuild:       *rebuild,
+		NoRebuild:     *noRebuild,
+		AptProxy:      *aptProxy,
 	}
+}
 
-	if *noRemove {
-		return nil
+// archiveDir returns where all built packages are stored.
+func archiveDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
 	}
 
-	return steps.Remove(dock, n)
+	return filepath.Join(home, Program), nil
 }
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/dawidd6/deber/pkg/log"
+	"github.com/dawidd6/deber/pkg/report"
+	"github.com/dawidd6/deber/pkg/util"
+	"github.com/spf13/pflag"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// matrixResult struct represents outcome of build for single target.
+type matrixResult struct {
+	target   string
+	status   string
+	duration time.Duration
+	err      error
+}
+
+// matrixCommand creates process building single target of matrix
+var matrixCommand = exec.Command
+
+// runMatrix builds package for every target distribution given in matrix,
+// running at most jobs builds at once.
+//
+// Every build is a separate process of this program, with distribution
+// set to one target, running in its own copy of source tree, so builds
+// don't clean and patch the same files at once. Copies are removed at the end.
+// Output of them is prefixed with target and summary is printed at the end.
+// Reports of builds, if requested, are collected into one batch report.
+func runMatrix(flags *pflag.FlagSet, dir string) error {
+	err := setOutput()
+	if err != nil {
+		return err
+	}
+
+	if *jobs < 1 {
+		return errors.New("at least one job is needed")
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	source, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(*buildDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	workDir, err := ioutil.TempDir(*buildDir, Program+"-matrix-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	sources, err := matrixSources(source, workDir, *matrix)
+	if err != nil {
+		return err
+	}
+
+	args := flagArgs(os.Args[1:], flags, "matrix", "jobs", "distribution", "report", "output")
+
+	results := make([]matrixResult, len(*matrix))
+	reports := make([]*report.Report, len(*matrix))
+	semaphore := make(chan bool, *jobs)
+	mutex := new(sync.Mutex)
+	wait := new(sync.WaitGroup)
+
+	for i, target := range *matrix {
+		wait.Add(1)
+
+		go func(i int, target string) {
+			defer wait.Done()
+
+			semaphore <- true
+			defer func() { <-semaphore }()
+
+			reportFile := filepath.Join(workDir, target+".json")
+
+			// Empty matrix stops config from enabling it again
+			cmd := matrixCommand(executable, append(append([]string{"build", sources[i], "--report", reportFile}, args...), "--distribution", target, "--matrix=")...)
+			start := time.Now()
+			err := runPrefixed(cmd, "["+target+"] ", mutex)
+
+			reports[i] = readReport(reportFile, filepath.Base(source), time.Since(start), err)
+			if reports[i].Target == "" {
+				reports[i].Target = target
+			}
+
+			results[i] = matrixResult{
+				target:   target,
+				status:   report.StatusSuccess,
+				duration: time.Since(start),
+				err:      err,
+			}
+			if err != nil {
+				results[i].status = report.StatusFailure
+			}
+		}(i, target)
+	}
+
+	wait.Wait()
+
+	batchReport := report.NewBatch()
+	for _, rep := range reports {
+		batchReport.Add(rep)
+	}
+
+	reportErr := writeBatchReport(batchReport)
+
+	err = printSummary(results)
+	if err != nil {
+		return err
+	}
+
+	return reportErr
+}
+
+// matrixSources copies source tree in given directory into work directory,
+// once for every target, returning paths of copies.
+//
+// Orig tarballs from parent directory of source are linked next to copies.
+func matrixSources(sourceDir, workDir string, targets []string) ([]string, error) {
+	tarballs, err := filepath.Glob(filepath.Join(filepath.Dir(sourceDir), "*.orig*.tar*"))
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]string, 0, len(targets))
+
+	for _, target := range targets {
+		parentDir := filepath.Join(workDir, target)
+		source := filepath.Join(parentDir, filepath.Base(sourceDir))
+
+		err = util.CopyTree(sourceDir, source)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tarball := range tarballs {
+			src, err := filepath.EvalSymlinks(tarball)
+			if err != nil {
+				return nil, err
+			}
+
+			err = util.LinkOrCopy(src, filepath.Join(parentDir, filepath.Base(tarball)))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+// runPrefixed runs command, writing its combined output
+// line by line with given prefix to log.
+func runPrefixed(cmd *exec.Cmd, prefix string, mutex *sync.Mutex) error {
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	done := make(chan bool)
+	go func() {
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			mutex.Lock()
+			fmt.Fprintln(log.Writer(), prefix+scanner.Text())
+			mutex.Unlock()
+		}
+		// Keep draining, so command doesn't block on too long line
+		io.Copy(ioutil.Discard, reader)
+		close(done)
+	}()
+
+	err := cmd.Run()
+	writer.Close()
+	<-done
+
+	return err
+}
+
+// printSummary prints table of matrix build results
+// and returns error if any of them failed.
+func printSummary(results []matrixResult) error {
+	failed := 0
+	writer := tabwriter.NewWriter(log.Writer(), 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(writer, "TARGET\tSTATUS\tDURATION")
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", result.target, result.status, result.duration.Round(time.Second))
+	}
+
+	err := writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d builds failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// argument struct represents single command line argument,
+// along with value given in the next one, if it's a flag needing it.
+type argument struct {
+	// flag is nil for positional arguments
+	flag  *pflag.Flag
+	words []string
+}
+
+// parseArgs splits command line arguments into flags and positional ones.
+func parseArgs(args []string, flags *pflag.FlagSet) []argument {
+	parsed := make([]argument, 0, len(args))
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		// Everything after terminator is not a flag
+		if arg == "--" {
+			for _, rest := range args[i:] {
+				parsed = append(parsed, argument{words: []string{rest}})
+			}
+			break
+		}
+
+		var flag *pflag.Flag
+		inline := false
+
+		switch {
+		case strings.HasPrefix(arg, "--"):
+			parts := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)
+			flag = flags.Lookup(parts[0])
+			inline = len(parts) == 2
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			flag = flags.ShorthandLookup(arg[1:2])
+			inline = len(arg) > 2
+		}
+
+		words := []string{arg}
+
+		// Value is the next argument, unless flag doesn't need one
+		if flag != nil && !inline && flag.NoOptDefVal == "" && i+1 < len(args) {
+			words = append(words, args[i+1])
+			i++
+		}
+
+		parsed = append(parsed, argument{flag: flag, words: words})
+	}
+
+	return parsed
+}
+
+// flagArgs returns only flags along with their values from command line
+// arguments, leaving out positional arguments and flags with given names.
+func flagArgs(args []string, flags *pflag.FlagSet, names ...string) []string {
+	kept := make([]string, 0, len(args))
+
+	for _, arg := range parseArgs(args, flags) {
+		if arg.flag != nil && !contains(names, arg.flag.Name) {
+			kept = append(kept, arg.words...)
+		}
+	}
+
+	return kept
+}
+
+// contains checks if slice has given string.
+func contains(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
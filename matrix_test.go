@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/dawidd6/deber/pkg/log"
+	"github.com/dawidd6/deber/pkg/report"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Every fake build takes the tarball away from its parent directory,
+// like Tarball step did before, and waits until the other one has started.
+const fakeBuild = `
+set -e
+cd "$2"
+test -f debian/changelog
+mv ../pkg_1.0.orig.tar.gz ../../$(basename $(dirname $PWD)).started
+for i in $(seq 100); do
+	[ $(ls ../.. | grep -c started) -eq 2 ] && exit 0
+	sleep 0.05
+done
+exit 1
+`
+
+// Every fake build but the one for trixie writes report
+const fakeReportBuild = `
+[ "$1" = build ] && [ "$3" = --report ] || exit 1
+target=$(basename $(dirname "$2"))
+[ $target = trixie ] && exit 1
+printf '{"source": "pkg", "target": "%s", "status": "success"}' $target > "$4"
+`
+
+func TestMatrixParallel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deber")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "pkg-1.0")
+	assert.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "debian"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(sourceDir, "debian", "changelog"), nil, 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "pkg_1.0.orig.tar.gz"), []byte("tarball"), 0644))
+
+	buffer := new(bytes.Buffer)
+	log.SetDefault(log.New(buffer, log.Options{Prefix: Program, Level: log.LevelNormal}))
+	defer log.SetDefault(log.New(os.Stdout, log.Options{Prefix: Program, Level: log.LevelNormal}))
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{Program}
+
+	matrixCommand = func(name string, args ...string) *exec.Cmd {
+		return exec.Command("sh", append([]string{"-c", fakeBuild, "sh"}, args...)...)
+	}
+	defer func() { matrixCommand = exec.Command }()
+
+	*matrix = []string{"bookworm", "trixie"}
+	*jobs = 2
+	*buildDir = dir
+	defer func() { *matrix = nil }()
+
+	err = runMatrix(pflag.CommandLine, sourceDir)
+	assert.NoError(t, err, buffer.String())
+	assert.Regexp(t, `bookworm\s+success`, buffer.String())
+	assert.Regexp(t, `trixie\s+success`, buffer.String())
+
+	// Original tarball is left in place and copies are removed
+	_, err = os.Stat(filepath.Join(dir, "pkg_1.0.orig.tar.gz"))
+	assert.NoError(t, err)
+
+	matches, err := filepath.Glob(filepath.Join(dir, Program+"-matrix-*"))
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestMatrixReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deber")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "pkg-1.0")
+	assert.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "debian"), os.ModePerm))
+
+	buffer := new(bytes.Buffer)
+	log.SetDefault(log.New(buffer, log.Options{Prefix: Program, Level: log.LevelNormal}))
+	defer log.SetDefault(log.New(os.Stdout, log.Options{Prefix: Program, Level: log.LevelNormal}))
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{Program}
+
+	matrixCommand = func(name string, args ...string) *exec.Cmd {
+		return exec.Command("sh", append([]string{"-c", fakeReportBuild, "sh"}, args...)...)
+	}
+	defer func() { matrixCommand = exec.Command }()
+
+	*matrix = []string{"bookworm", "trixie"}
+	*jobs = 2
+	*buildDir = dir
+	*reportFile = filepath.Join(dir, "matrix.json")
+	defer func() { *matrix = nil }()
+	defer func() { *reportFile = "" }()
+
+	err = runMatrix(pflag.CommandLine, sourceDir)
+	assert.Error(t, err)
+
+	data, err := ioutil.ReadFile(*reportFile)
+	assert.NoError(t, err)
+
+	batchReport := new(report.Batch)
+	assert.NoError(t, json.Unmarshal(data, batchReport))
+	assert.Equal(t, report.StatusFailure, batchReport.Status)
+	assert.Len(t, batchReport.Reports, 2)
+	assert.Equal(t, "bookworm", batchReport.Reports[0].Target)
+	assert.Equal(t, report.StatusSuccess, batchReport.Reports[0].Status)
+	assert.Equal(t, "trixie", batchReport.Reports[1].Target)
+	assert.Equal(t, report.StatusFailure, batchReport.Reports[1].Status)
+}
@@ -0,0 +1,109 @@
+// Package arch includes Debian architecture helpers
+package arch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// BinfmtDir constant represents where binfmt_misc handlers are registered
+const BinfmtDir = "/proc/sys/fs/binfmt_misc"
+
+// platforms maps Debian architecture names to Docker platforms
+var platforms = map[string]string{
+	"amd64":    "linux/amd64",
+	"arm64":    "linux/arm64",
+	"armel":    "linux/arm/v5",
+	"armhf":    "linux/arm/v7",
+	"i386":     "linux/386",
+	"mips64el": "linux/mips64le",
+	"ppc64el":  "linux/ppc64le",
+	"riscv64":  "linux/riscv64",
+	"s390x":    "linux/s390x",
+}
+
+// goarchs maps Go architecture names to Debian architecture names
+var goarchs = map[string]string{
+	"amd64":    "amd64",
+	"arm64":    "arm64",
+	"arm":      "armhf",
+	"386":      "i386",
+	"mips64le": "mips64el",
+	"ppc64le":  "ppc64el",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// emulators maps Debian architecture names to qemu-user binary suffixes
+var emulators = map[string]string{
+	"amd64":    "x86_64",
+	"arm64":    "aarch64",
+	"armel":    "arm",
+	"armhf":    "arm",
+	"i386":     "i386",
+	"mips64el": "mips64el",
+	"ppc64el":  "ppc64le",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// Native function returns Debian architecture name of the host.
+func Native() string {
+	arch, ok := goarchs[runtime.GOARCH]
+	if !ok {
+		return runtime.GOARCH
+	}
+
+	return arch
+}
+
+// Platform function returns Docker platform for given Debian architecture.
+func Platform(arch string) (string, error) {
+	platform, ok := platforms[arch]
+	if !ok {
+		return "", fmt.Errorf("unsupported architecture: %s", arch)
+	}
+
+	return platform, nil
+}
+
+// IsForeign function checks if given architecture
+// can't be executed natively on the host.
+func IsForeign(arch string) bool {
+	native := Native()
+
+	if arch == "" || arch == native {
+		return false
+	}
+
+	// amd64 hosts can run i386 binaries without emulation
+	if native == "amd64" && arch == "i386" {
+		return false
+	}
+
+	return true
+}
+
+// CheckEmulation function checks if qemu-user binfmt_misc handler
+// for given architecture is registered on the host.
+func CheckEmulation(arch string) error {
+	if !IsForeign(arch) {
+		return nil
+	}
+
+	emulator, ok := emulators[arch]
+	if !ok {
+		return fmt.Errorf("unsupported architecture: %s", arch)
+	}
+
+	handler := filepath.Join(BinfmtDir, "qemu-"+emulator)
+
+	_, err := os.Stat(handler)
+	if err != nil {
+		return fmt.Errorf("binfmt_misc handler for %s not registered, install qemu-user-static", arch)
+	}
+
+	return nil
+}
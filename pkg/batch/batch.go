@@ -0,0 +1,122 @@
+// Package batch includes ordering of multiple source packages
+package batch
+
+import (
+	"fmt"
+	"github.com/dawidd6/deber/pkg/control"
+	"path/filepath"
+	"strings"
+)
+
+// Source struct represents single source package tree.
+type Source struct {
+	// Dir is the directory where source lives
+	Dir string
+	// Name is the name of source package
+	Name string
+	// Binaries are names of binary packages built from source
+	Binaries []string
+	// BuildDepends are names of packages needed to build source
+	BuildDepends []string
+}
+
+// Load function reads debian/control of source in given directory.
+func Load(dir string) (*Source, error) {
+	paragraphs, err := control.ParseFile(filepath.Join(dir, "debian", "control"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paragraphs) < 1 || paragraphs[0].Get("Source") == "" {
+		return nil, fmt.Errorf("%s: no source paragraph in debian/control", dir)
+	}
+
+	source := &Source{
+		Dir:          dir,
+		Name:         paragraphs[0].Get("Source"),
+		Binaries:     make([]string, 0),
+		BuildDepends: make([]string, 0),
+	}
+
+	for _, field := range []string{"Build-Depends", "Build-Depends-Arch", "Build-Depends-Indep"} {
+		source.BuildDepends = append(source.BuildDepends, paragraphs[0].Relations(field)...)
+	}
+
+	for _, paragraph := range paragraphs[1:] {
+		name := paragraph.Get("Package")
+		if name != "" {
+			source.Binaries = append(source.Binaries, name)
+		}
+	}
+
+	return source, nil
+}
+
+// Sort function orders given sources, so every source comes after
+// sources building packages it build-depends on.
+//
+// Independent sources keep their given order.
+// Dependency cycle results in error.
+func Sort(sources []*Source) ([]*Source, error) {
+	// Which source builds which binary package
+	builtBy := make(map[string]*Source)
+	for _, source := range sources {
+		for _, binary := range source.Binaries {
+			builtBy[binary] = source
+		}
+	}
+
+	// Which sources need to be built before given one
+	needs := make(map[*Source]map[*Source]bool)
+	for _, source := range sources {
+		needs[source] = make(map[*Source]bool)
+
+		for _, dep := range source.BuildDepends {
+			other, ok := builtBy[dep]
+			if ok && other != source {
+				needs[source][other] = true
+			}
+		}
+	}
+
+	sorted := make([]*Source, 0, len(sources))
+	done := make(map[*Source]bool)
+
+	for len(sorted) < len(sources) {
+		progress := false
+
+		for _, source := range sources {
+			if done[source] || !ready(needs[source], done) {
+				continue
+			}
+
+			sorted = append(sorted, source)
+			done[source] = true
+			progress = true
+		}
+
+		if !progress {
+			names := make([]string, 0)
+			for _, source := range sources {
+				if !done[source] {
+					names = append(names, source.Name)
+				}
+			}
+
+			return nil, fmt.Errorf("build dependency cycle between sources: %s", strings.Join(names, ", "))
+		}
+	}
+
+	return sorted, nil
+}
+
+// ready checks if all needed sources are done.
+func ready(needs, done map[*Source]bool) bool {
+	for source := range needs {
+		if !done[source] {
+			return false
+		}
+	}
+
+	return true
+}
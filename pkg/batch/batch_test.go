@@ -0,0 +1,53 @@
+package batch_test
+
+import (
+	"github.com/dawidd6/deber/pkg/batch"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "debian"), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "debian", "control"), []byte(`Source: app
+Build-Depends: debhelper-compat (= 13), libfoo-dev (>= 1.0)
+Build-Depends-Indep: python3-sphinx
+
+Package: app
+Architecture: any
+`), 0644)
+	assert.NoError(t, err)
+
+	source, err := batch.Load(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "app", source.Name)
+	assert.Equal(t, []string{"app"}, source.Binaries)
+	assert.Equal(t, []string{"debhelper-compat", "libfoo-dev", "python3-sphinx"}, source.BuildDepends)
+}
+
+func TestSort(t *testing.T) {
+	app := &batch.Source{Name: "app", Binaries: []string{"app"}, BuildDepends: []string{"libfoo-dev", "libbar-dev"}}
+	foo := &batch.Source{Name: "foo", Binaries: []string{"libfoo1", "libfoo-dev"}, BuildDepends: []string{"libbar-dev"}}
+	bar := &batch.Source{Name: "bar", Binaries: []string{"libbar1", "libbar-dev"}, BuildDepends: []string{"debhelper-compat"}}
+	other := &batch.Source{Name: "other", Binaries: []string{"other"}}
+
+	sorted, err := batch.Sort([]*batch.Source{app, other, foo, bar})
+	assert.NoError(t, err)
+	assert.Equal(t, []*batch.Source{other, bar, foo, app}, sorted)
+}
+
+func TestSortCycle(t *testing.T) {
+	foo := &batch.Source{Name: "foo", Binaries: []string{"foo"}, BuildDepends: []string{"bar"}}
+	bar := &batch.Source{Name: "bar", Binaries: []string{"bar"}, BuildDepends: []string{"foo"}}
+
+	_, err := batch.Sort([]*batch.Source{foo, bar})
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+// Package config includes configuration loading utilities
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/spf13/pflag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config maps long flag names to their values.
+//
+// Multiple values are allowed, so flags that can be repeated
+// on command line can be repeated in config too.
+type Config map[string][]string
+
+// Parse function reads config in "key = value" format from given reader.
+//
+// Empty lines and lines starting with '#' are ignored.
+func Parse(reader io.Reader) (Config, error) {
+	config := make(Config)
+	scanner := bufio.NewScanner(reader)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected key = value", line)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		if key == "" {
+			return nil, fmt.Errorf("line %d: empty key", line)
+		}
+
+		config[key] = append(config[key], value)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// ParseFile function reads config file from given path.
+//
+// Non existent file results in empty config.
+func ParseFile(path string) (Config, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return make(Config), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return config, nil
+}
+
+// ParseEnv function extracts config from environment variables
+// with given prefix.
+//
+// PREFIX_LINTIAN_FLAGS variable is translated to "lintian-flags" key.
+func ParseEnv(prefix string, environ []string) Config {
+	config := make(Config)
+
+	for _, env := range environ {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], prefix) {
+			continue
+		}
+
+		key := strings.TrimPrefix(parts[0], prefix)
+		key = strings.ToLower(strings.Replace(key, "_", "-", -1))
+		config[key] = []string{parts[1]}
+	}
+
+	return config
+}
+
+// Merge function merges given configs into one.
+//
+// Keys of later configs replace the same keys of earlier ones.
+func Merge(configs ...Config) Config {
+	merged := make(Config)
+
+	for _, config := range configs {
+		for key, values := range config {
+			merged[key] = values
+		}
+	}
+
+	return merged
+}
+
+// Apply function sets flags to config values,
+// but only if they were not changed on command line.
+//
+// Keys not matching any of given flags are skipped if they are
+// among known flags, as they belong to other commands.
+// Keys matching no flag at all are an error.
+func (config Config) Apply(flags, known *pflag.FlagSet) error {
+	for key, values := range config {
+		if known.Lookup(key) == nil {
+			return fmt.Errorf("unknown config key: %s", key)
+		}
+
+		flag := flags.Lookup(key)
+		if flag == nil || flag.Changed {
+			continue
+		}
+
+		for _, value := range values {
+			err := flags.Set(key, value)
+			if err != nil {
+				return fmt.Errorf("invalid value for config key %s: %s", key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Load function reads per-user config, per-project config of package
+// in given directory and environment, then applies them to flags
+// in that order of precedence.
+//
+// Per-user config lives in ~/.config/<program>/config,
+// per-project config in debian/<program>.conf
+// and environment variables are prefixed with <PROGRAM>_.
+//
+// Known flags are flags of all commands, environment variables
+// not matching any of them are ignored, as they may serve other purpose.
+func Load(program, dir string, flags, known *pflag.FlagSet) error {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return err
+	}
+
+	user, err := ParseFile(filepath.Join(configDir, program, "config"))
+	if err != nil {
+		return err
+	}
+
+	project, err := ParseFile(filepath.Join(dir, "debian", program+".conf"))
+	if err != nil {
+		return err
+	}
+
+	env := ParseEnv(strings.ToUpper(program)+"_", os.Environ())
+	for key := range env {
+		if known.Lookup(key) == nil {
+			delete(env, key)
+		}
+	}
+
+	return Merge(user, project, env).Apply(flags, known)
+}
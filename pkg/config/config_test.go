@@ -0,0 +1,99 @@
+package config_test
+
+import (
+	"github.com/dawidd6/deber/pkg/config"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	reader := strings.NewReader(`
+# comment
+lintian-flags = -i -I --pedantic
+package = /path/one
+package=/path/two
+`)
+
+	c, err := config.Parse(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-i -I --pedantic"}, c["lintian-flags"])
+	assert.Equal(t, []string{"/path/one", "/path/two"}, c["package"])
+}
+
+func TestParseInvalid(t *testing.T) {
+	reader := strings.NewReader("lintian-flags")
+
+	_, err := config.Parse(reader)
+	assert.Error(t, err)
+}
+
+func TestParseEnv(t *testing.T) {
+	environ := []string{
+		"HOME=/home/user",
+		"DEBER_LINTIAN_FLAGS=-i",
+		"DEBER_AGE=1h",
+	}
+
+	c := config.ParseEnv("DEBER_", environ)
+	assert.Equal(t, config.Config{
+		"lintian-flags": {"-i"},
+		"age":           {"1h"},
+	}, c)
+}
+
+func TestMergeAndApply(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	lintianFlags := flags.String("lintian-flags", "-i -I", "")
+	dpkgFlags := flags.String("dpkg-flags", "-tc", "")
+	packages := flags.StringArray("package", nil, "")
+	age := flags.Duration("age", time.Hour, "")
+
+	err := flags.Parse([]string{"--dpkg-flags", "-b"})
+	assert.NoError(t, err)
+
+	user := config.Config{
+		"lintian-flags": {"--pedantic"},
+		"package":       {"/user/one", "/user/two"},
+		"dpkg-flags":    {"-S"},
+	}
+	project := config.Config{
+		"package": {"/project"},
+	}
+	env := config.Config{
+		"age": {"2h"},
+	}
+
+	err = config.Merge(user, project, env).Apply(flags, flags)
+	assert.NoError(t, err)
+	assert.Equal(t, "--pedantic", *lintianFlags)
+	assert.Equal(t, "-b", *dpkgFlags)
+	assert.Equal(t, []string{"/project"}, *packages)
+	assert.Equal(t, time.Hour*2, *age)
+}
+
+func TestApplyUnknown(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+
+	err := config.Config{"unknown": {"value"}}.Apply(flags, flags)
+	assert.Error(t, err)
+}
+
+func TestApplyOtherCommand(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	known := pflag.NewFlagSet("all", pflag.ContinueOnError)
+	known.String("older-than", "", "")
+
+	err := config.Config{"older-than": {"720h"}}.Apply(flags, known)
+	assert.NoError(t, err)
+}
+
+func TestApplyInvalid(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Duration("age", time.Hour, "")
+
+	err := config.Config{"age": {"two hours"}}.Apply(flags, flags)
+	assert.Error(t, err)
+}
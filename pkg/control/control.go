@@ -0,0 +1,195 @@
+// Package control includes Debian control files parsing utilities
+package control
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	signedHeader    = "-----BEGIN PGP SIGNED MESSAGE-----"
+	signatureHeader = "-----BEGIN PGP SIGNATURE-----"
+)
+
+// Field struct represents single field of paragraph.
+//
+// Value of multiline field keeps continuation lines as they are,
+// separated by newlines.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Paragraph type represents ordered fields of single paragraph.
+type Paragraph []Field
+
+// Get function returns value of field with given name,
+// names are case insensitive.
+func (paragraph Paragraph) Get(name string) string {
+	for _, field := range paragraph {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+
+	return ""
+}
+
+// Lines function returns non empty trimmed lines of multiline field.
+func (paragraph Paragraph) Lines(name string) []string {
+	lines := make([]string, 0)
+
+	for _, line := range strings.Split(paragraph.Get(name), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// Relations function returns names of packages mentioned in
+// relationship field (like Depends or Build-Depends) with given name,
+// including all alternatives and without versions, architectures or profiles.
+func (paragraph Paragraph) Relations(name string) []string {
+	names := make([]string, 0)
+
+	for _, relation := range strings.Split(paragraph.Get(name), ",") {
+		for _, alternative := range strings.Split(relation, "|") {
+			fields := strings.FieldsFunc(alternative, func(r rune) bool {
+				return strings.ContainsRune(" \t\n([<:", r)
+			})
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "${") {
+				continue
+			}
+
+			names = append(names, fields[0])
+		}
+	}
+
+	return names
+}
+
+// Set function replaces value of field with given name
+// or appends new field if there is none.
+func (paragraph *Paragraph) Set(name, value string) {
+	for i, field := range *paragraph {
+		if strings.EqualFold(field.Name, name) {
+			(*paragraph)[i].Value = value
+			return
+		}
+	}
+
+	*paragraph = append(*paragraph, Field{Name: name, Value: value})
+}
+
+// String function formats paragraph back into control file syntax.
+func (paragraph Paragraph) String() string {
+	builder := new(strings.Builder)
+
+	for _, field := range paragraph {
+		if strings.HasPrefix(field.Value, "\n") {
+			fmt.Fprintf(builder, "%s:%s\n", field.Name, field.Value)
+		} else {
+			fmt.Fprintf(builder, "%s: %s\n", field.Name, field.Value)
+		}
+	}
+
+	return builder.String()
+}
+
+// Parse function reads all paragraphs from given reader.
+//
+// OpenPGP cleartext signature, if present, is stripped without
+// verification, comments are skipped.
+func Parse(reader io.Reader) ([]Paragraph, error) {
+	paragraphs := make([]Paragraph, 0)
+	paragraph := make(Paragraph, 0)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	signed := false
+
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+
+		if line == 1 && text == signedHeader {
+			signed = true
+			// Skip armor headers
+			for scanner.Scan() && scanner.Text() != "" {
+			}
+			continue
+		}
+
+		if signed && text == signatureHeader {
+			break
+		}
+
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.TrimSpace(text) == "" {
+			if len(paragraph) > 0 {
+				paragraphs = append(paragraphs, paragraph)
+				paragraph = make(Paragraph, 0)
+			}
+			continue
+		}
+
+		if text[0] == ' ' || text[0] == '\t' {
+			if len(paragraph) == 0 {
+				return nil, fmt.Errorf("line %d: continuation line without field", line)
+			}
+
+			paragraph[len(paragraph)-1].Value += "\n" + text
+			continue
+		}
+
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected field", line)
+		}
+
+		paragraph = append(paragraph, Field{
+			Name:  parts[0],
+			Value: strings.TrimSpace(parts[1]),
+		})
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paragraph) > 0 {
+		paragraphs = append(paragraphs, paragraph)
+	}
+
+	return paragraphs, nil
+}
+
+// ParseBytes function reads all paragraphs from given bytes.
+func ParseBytes(data []byte) ([]Paragraph, error) {
+	return Parse(bytes.NewReader(data))
+}
+
+// ParseFile function reads all paragraphs from file at given path.
+func ParseFile(path string) ([]Paragraph, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	paragraphs, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return paragraphs, nil
+}
@@ -0,0 +1,84 @@
+package control_test
+
+import (
+	"github.com/dawidd6/deber/pkg/control"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const dsc = `-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA256
+
+Format: 3.0 (quilt)
+Source: pkg
+Binary: pkg, libpkg1
+Version: 1.0-1
+Build-Depends: debhelper-compat (= 12),
+ libfoo-dev
+Files:
+ 0123 100 pkg_1.0.orig.tar.gz
+ 4567 200 pkg_1.0-1.debian.tar.xz
+-----BEGIN PGP SIGNATURE-----
+
+iQIzBAEBCAAdFiEE
+-----END PGP SIGNATURE-----
+`
+
+func TestParseSigned(t *testing.T) {
+	paragraphs, err := control.Parse(strings.NewReader(dsc))
+	assert.NoError(t, err)
+	assert.Len(t, paragraphs, 1)
+
+	p := paragraphs[0]
+	assert.Equal(t, "pkg", p.Get("source"))
+	assert.Equal(t, "debhelper-compat (= 12),\n libfoo-dev", p.Get("Build-Depends"))
+	assert.Equal(t, []string{
+		"0123 100 pkg_1.0.orig.tar.gz",
+		"4567 200 pkg_1.0-1.debian.tar.xz",
+	}, p.Lines("Files"))
+}
+
+func TestParseMultiple(t *testing.T) {
+	paragraphs, err := control.Parse(strings.NewReader(`Source: pkg
+# comment
+
+Package: pkg
+Architecture: any
+
+
+Package: libpkg1
+Architecture: any
+`))
+	assert.NoError(t, err)
+	assert.Len(t, paragraphs, 3)
+	assert.Equal(t, "libpkg1", paragraphs[2].Get("Package"))
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := control.Parse(strings.NewReader(" continuation\n"))
+	assert.Error(t, err)
+
+	_, err = control.Parse(strings.NewReader("no field here\n"))
+	assert.Error(t, err)
+}
+
+func TestParagraphString(t *testing.T) {
+	p := control.Paragraph{
+		{Name: "Source", Value: "pkg"},
+		{Name: "Files", Value: "\n 0123 100 pkg.tar.gz"},
+	}
+	p.Set("Version", "1.0")
+	p.Set("source", "other")
+
+	assert.Equal(t, "Source: other\nFiles:\n 0123 100 pkg.tar.gz\nVersion: 1.0\n", p.String())
+}
+
+func TestParagraphRelations(t *testing.T) {
+	p := control.Paragraph{
+		{Name: "Build-Depends", Value: "debhelper-compat (= 13),\n libfoo-dev [amd64] | libbar-dev,\n python3:native, pkg-config <!nocheck>, ${misc:Depends}"},
+	}
+
+	assert.Equal(t, []string{"debhelper-compat", "libfoo-dev", "libbar-dev", "python3", "pkg-config"}, p.Relations("Build-Depends"))
+	assert.Empty(t, p.Relations("Build-Depends-Indep"))
+}
@@ -0,0 +1,154 @@
+// Package distro includes offline distribution table
+package distro
+
+import (
+	"fmt"
+	"github.com/dawidd6/deber/pkg/config"
+	"github.com/dawidd6/deber/pkg/registry"
+	"strings"
+)
+
+const (
+	// Debian constant represents Debian image repository
+	Debian = "debian"
+	// Ubuntu constant represents Ubuntu image repository
+	Ubuntu = "ubuntu"
+)
+
+// suffixes are suite suffixes which don't change distribution
+var suffixes = []string{
+	"-backports-sloppy",
+	"-backports",
+	"-security",
+	"-updates",
+	"-proposed",
+}
+
+// Resolver struct holds everything needed to determine
+// parent image of target distribution.
+type Resolver struct {
+	// Images maps targets to image references, taking precedence over everything else,
+	// references without tag are tagged with target
+	Images map[string]string
+	// Table maps targets to repositories offline
+	Table Table
+	// Repos are repositories looked up in registry if target is not in table
+	Repos []string
+	// Registry is where images are pulled from and looked up in
+	Registry *registry.Client
+}
+
+// Table maps distribution codenames and suites to image repositories.
+type Table map[string]string
+
+// Default function returns built-in table of known
+// Debian and Ubuntu codenames and suites.
+func Default() Table {
+	table := make(Table)
+
+	debian := []string{
+		"jessie", "stretch", "buster", "bullseye", "bookworm", "trixie", "forky", "duke",
+		"oldoldstable", "oldstable", "stable", "testing", "unstable", "sid", "experimental", "rc-buggy",
+	}
+	ubuntu := []string{
+		"trusty", "xenial", "bionic", "focal", "jammy", "lunar", "mantic",
+		"noble", "oracular", "plucky", "questing", "resolute",
+		"devel", "rolling",
+	}
+
+	for _, name := range debian {
+		table[name] = Debian
+	}
+
+	for _, name := range ubuntu {
+		table[name] = Ubuntu
+	}
+
+	return table
+}
+
+// ParseFile function reads table from file at given path.
+//
+// Each line maps distribution to repository in "codename = repo" format.
+// Non existent file results in empty table.
+func ParseFile(path string) (Table, error) {
+	conf, err := config.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(Table)
+
+	for name, repos := range conf {
+		repo := repos[len(repos)-1]
+		if strings.ContainsAny(repo, " \t") {
+			return nil, fmt.Errorf("%s: invalid repository for %s: %s", path, name, repo)
+		}
+
+		table[name] = repo
+	}
+
+	return table, nil
+}
+
+// Merge function adds entries of other table,
+// replacing existing ones.
+func (table Table) Merge(other Table) {
+	for name, repo := range other {
+		table[name] = repo
+	}
+}
+
+// Match function returns repository of given target distribution.
+//
+// Suite suffixes like "-backports" or "-security" are stripped
+// if target is not found as is.
+func (table Table) Match(target string) (string, bool) {
+	repo, ok := table[target]
+	if ok {
+		return repo, true
+	}
+
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(target, suffix) {
+			repo, ok = table[strings.TrimSuffix(target, suffix)]
+			return repo, ok
+		}
+	}
+
+	return "", false
+}
+
+// Resolve function returns reference of parent image for given target.
+//
+// Explicit image mapping is checked first, then offline table
+// and at last registry is queried for tags of repositories.
+func (resolver *Resolver) Resolve(target string) (string, error) {
+	image, ok := resolver.Images[target]
+	if ok {
+		return withTag(image, target), nil
+	}
+
+	repo, ok := resolver.Table.Match(target)
+	if !ok {
+		var err error
+
+		repo, err = resolver.Registry.MatchRepo(resolver.Repos, target)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return resolver.Registry.Reference(repo) + ":" + target, nil
+}
+
+// withTag returns given image reference tagged with tag,
+// unless it's already tagged or pinned to digest.
+func withTag(image, tag string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if strings.ContainsAny(name, ":@") {
+		return image
+	}
+
+	return image + ":" + tag
+}
@@ -0,0 +1,85 @@
+package distro_test
+
+import (
+	"github.com/dawidd6/deber/pkg/distro"
+	"github.com/dawidd6/deber/pkg/registry"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	table := distro.Default()
+
+	cases := map[string]string{
+		"bookworm":           distro.Debian,
+		"bookworm-backports": distro.Debian,
+		"trixie-security":    distro.Debian,
+		"sid":                distro.Debian,
+		"stable":             distro.Debian,
+		"noble":              distro.Ubuntu,
+		"jammy-updates":      distro.Ubuntu,
+	}
+
+	for target, expected := range cases {
+		repo, ok := table.Match(target)
+		assert.True(t, ok, target)
+		assert.Equal(t, expected, repo, target)
+	}
+
+	_, ok := table.Match("nonexistent")
+	assert.False(t, ok)
+}
+
+func TestParseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "distributions")
+	err = ioutil.WriteFile(path, []byte("# new release\nfuture = ubuntu\nsid = mydebian\n"), 0644)
+	assert.NoError(t, err)
+
+	table := distro.Default()
+	other, err := distro.ParseFile(path)
+	assert.NoError(t, err)
+	table.Merge(other)
+
+	repo, ok := table.Match("future-proposed")
+	assert.True(t, ok)
+	assert.Equal(t, distro.Ubuntu, repo)
+
+	repo, _ = table.Match("sid")
+	assert.Equal(t, "mydebian", repo)
+}
+
+func TestResolve(t *testing.T) {
+	client, err := registry.New("registry.corp")
+	assert.NoError(t, err)
+
+	resolver := &distro.Resolver{
+		Images: map[string]string{
+			"beowulf":      "devuan/devuan",
+			"kali-rolling": "kalilinux/kali-rolling:latest",
+			"bullseye":     "debian@sha256:0123",
+		},
+		Table:    distro.Default(),
+		Registry: client,
+	}
+
+	cases := map[string]string{
+		"beowulf":            "devuan/devuan:beowulf",
+		"kali-rolling":       "kalilinux/kali-rolling:latest",
+		"bullseye":           "debian@sha256:0123",
+		"bookworm-backports": "registry.corp/debian:bookworm-backports",
+		"noble":              "registry.corp/ubuntu:noble",
+	}
+
+	for target, expected := range cases {
+		image, err := resolver.Resolve(target)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, image)
+	}
+}
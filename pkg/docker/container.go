@@ -52,6 +52,8 @@ type ContainerExecArgs struct {
 	AsRoot      bool
 	Skip        bool
 	Network     bool
+	// Output is where command output goes, Stdout by default
+	Output io.Writer
 }
 
 // IsContainerCreated function checks if container is created
@@ -158,6 +160,21 @@ func (docker *Docker) ContainerRemove(name string) error {
 	return docker.cli.ContainerRemove(docker.ctx, name, options)
 }
 
+// ContainerAge function returns the time since container creation.
+func (docker *Docker) ContainerAge(name string) (time.Duration, error) {
+	inspect, err := docker.cli.ContainerInspect(docker.ctx, name)
+	if err != nil {
+		return time.Second, err
+	}
+
+	created, err := time.Parse(time.RFC3339Nano, inspect.Created)
+	if err != nil {
+		return time.Second, err
+	}
+
+	return time.Since(created), nil
+}
+
 // ContainerMounts returns mounts of created container.
 func (docker *Docker) ContainerMounts(name string) ([]mount.Mount, error) {
 	inspect, err := docker.cli.ContainerInspect(docker.ctx, name)
@@ -250,7 +267,12 @@ func (docker *Docker) ContainerExec(args ContainerExecArgs) error {
 		}
 	}
 
-	io.Copy(os.Stdout, hijack.Conn)
+	output := args.Output
+	if output == nil {
+		output = os.Stdout
+	}
+
+	io.Copy(output, hijack.Conn)
 	hijack.Close()
 
 	if !args.Interactive {
@@ -268,7 +290,7 @@ func (docker *Docker) ContainerExec(args ContainerExecArgs) error {
 }
 
 func (docker *Docker) resizeIfChanged(execID string, fd uintptr) {
-	channel := make(chan os.Signal)
+	channel := make(chan os.Signal, 1)
 	signal.Notify(channel, syscall.SIGWINCH)
 
 	for {
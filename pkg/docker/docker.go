@@ -3,12 +3,17 @@ package docker
 
 import (
 	"context"
+	"errors"
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	"net"
 )
 
 const (
 	// APIVersion constant is the minimum supported version of Docker Engine API
-	APIVersion = "1.30"
+	//
+	// 1.32 is needed for building images of foreign platforms.
+	APIVersion = "1.32"
 )
 
 // Docker struct represents Docker client.
@@ -29,3 +34,21 @@ func New() (*Docker, error) {
 		ctx: context.Background(),
 	}, nil
 }
+
+// NetworkGateway function returns gateway address of bridge network,
+// under which host is reachable from containers.
+func (docker *Docker) NetworkGateway() (string, error) {
+	inspect, err := docker.cli.NetworkInspect(docker.ctx, "bridge", types.NetworkInspectOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	for _, config := range inspect.IPAM.Config {
+		// apt doesn't like IPv6 addresses in proxy URLs much
+		if net.ParseIP(config.Gateway).To4() != nil {
+			return config.Gateway, nil
+		}
+	}
+
+	return "", errors.New("bridge network has no gateway")
+}
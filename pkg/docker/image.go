@@ -4,9 +4,12 @@ import (
 	"archive/tar"
 	"bytes"
 	"errors"
+	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/term"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -40,19 +43,113 @@ func (docker *Docker) ImageAge(name string) (time.Duration, error) {
 	return time.Since(inspect.Metadata.LastTagTime), nil
 }
 
+// ImageLabels function returns labels of image with given name.
+func (docker *Docker) ImageLabels(name string) (map[string]string, error) {
+	inspect, _, err := docker.cli.ImageInspectWithRaw(docker.ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if inspect.Config == nil {
+		return map[string]string{}, nil
+	}
+
+	return inspect.Config.Labels, nil
+}
+
+// ImageDigest function queries registry for digest of image
+// with given reference, without pulling it.
+func (docker *Docker) ImageDigest(ref string) (string, error) {
+	inspect, err := docker.cli.DistributionInspect(docker.ctx, ref, "")
+	if err != nil {
+		return "", err
+	}
+
+	return inspect.Descriptor.Digest.String(), nil
+}
+
+// ImageRepoDigest function returns digest of local image with given reference,
+// recorded when it was pulled from registry.
+//
+// Empty digest is returned if image doesn't exist locally, wasn't pulled
+// from registry or is not of given platform, if any.
+func (docker *Docker) ImageRepoDigest(ref, platform string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", err
+	}
+
+	inspect, _, err := docker.cli.ImageInspectWithRaw(docker.ctx, ref)
+	if client.IsErrNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Tag points to image of the last pulled platform only
+	if platform != "" {
+		parts := strings.Split(platform, "/")
+		if len(parts) < 2 || parts[0] != inspect.Os || parts[1] != inspect.Architecture {
+			return "", nil
+		}
+	}
+
+	for _, repoDigest := range inspect.RepoDigests {
+		digested, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil {
+			continue
+		}
+
+		canonical, ok := digested.(reference.Canonical)
+		if ok && canonical.Name() == named.Name() {
+			return canonical.Digest().String(), nil
+		}
+	}
+
+	return "", nil
+}
+
+// ImageBuildArgs struct represents arguments
+// passed to ImageBuild().
+type ImageBuildArgs struct {
+	Name       string
+	Dockerfile []byte
+	Platform   string
+	Labels     map[string]string
+	// PullParent makes Docker Engine pull parent image even if it exists
+	PullParent bool
+	// HTTPProxy is passed to build as http_proxy argument,
+	// which is not stored in image
+	HTTPProxy string
+	// Output is where build output goes, Stdout by default
+	Output io.Writer
+}
+
 // ImageBuild function build image from dockerfile
 // and prints output to Stdout.
-func (docker *Docker) ImageBuild(name string, dockerFile []byte) error {
+//
+// Image can be built for foreign platform, in that case
+// parent image of that platform is used.
+func (docker *Docker) ImageBuild(args ImageBuildArgs) error {
 	buffer := new(bytes.Buffer)
 	writer := tar.NewWriter(buffer)
 	header := &tar.Header{
 		Name: "Dockerfile",
-		Size: int64(len(dockerFile)),
+		Size: int64(len(args.Dockerfile)),
 	}
 	options := types.ImageBuildOptions{
-		Tags:       []string{name},
+		Tags:       []string{args.Name},
 		Remove:     true,
-		PullParent: true,
+		PullParent: args.PullParent,
+		Platform:   args.Platform,
+		Labels:     args.Labels,
+	}
+
+	if args.HTTPProxy != "" {
+		options.BuildArgs = map[string]*string{
+			"http_proxy": &args.HTTPProxy,
+		}
 	}
 
 	err := writer.WriteHeader(header)
@@ -60,7 +157,7 @@ func (docker *Docker) ImageBuild(name string, dockerFile []byte) error {
 		return err
 	}
 
-	_, err = writer.Write(dockerFile)
+	_, err = writer.Write(args.Dockerfile)
 	if err != nil {
 		return err
 	}
@@ -75,8 +172,13 @@ func (docker *Docker) ImageBuild(name string, dockerFile []byte) error {
 		return err
 	}
 
-	termFd, isTerm := term.GetFdInfo(os.Stdout)
-	err = jsonmessage.DisplayJSONMessagesStream(response.Body, os.Stdout, termFd, isTerm, nil)
+	output := args.Output
+	if output == nil {
+		output = os.Stdout
+	}
+
+	termFd, isTerm := term.GetFdInfo(output)
+	err = jsonmessage.DisplayJSONMessagesStream(response.Body, output, termFd, isTerm, nil)
 	if err != nil {
 		return err
 	}
@@ -86,7 +188,7 @@ func (docker *Docker) ImageBuild(name string, dockerFile []byte) error {
 		return err
 	}
 
-	_, _, err = docker.cli.ImageInspectWithRaw(docker.ctx, name)
+	_, _, err = docker.cli.ImageInspectWithRaw(docker.ctx, args.Name)
 	if err != nil {
 		return errors.New("image didn't built successfully")
 	}
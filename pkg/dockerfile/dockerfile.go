@@ -3,24 +3,39 @@ package dockerfile
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/dawidd6/deber/pkg/naming"
+	"io/ioutil"
 	"text/template"
 )
 
 // Template struct defines parameters passed to
 // dockerfile template.
 type Template struct {
-	// Repo is the image repository
-	Repo string
-	// Tag is the image tag
-	Tag string
+	// From is the parent image reference
+	From string
 	// SourceDir = /build/source
 	SourceDir string
+	// HostArch is the foreign architecture to cross-build for
+	HostArch string
+	// CrossSources is shell command adding apt sources of HostArch
+	CrossSources string
+}
+
+// Customization struct holds user supplied changes to Dockerfile.
+type Customization struct {
+	// Template replaces built-in template if not empty
+	Template string
+	// Extra is appended to rendered Dockerfile
+	Extra string
 }
 
 const dockerfileTemplate = `
 # From which Docker image do we start?
-FROM {{ .Repo }}:{{ .Tag }}
+FROM {{ .From }}
 
 # Remove not needed apt configs.
 RUN rm /etc/apt/apt.conf.d/*
@@ -37,8 +52,15 @@ RUN printf "Package: *\nPin: origin \"\"\nPin-Priority: 990\n" > /etc/apt/prefer
 # Install required packages.
 RUN apt-get update && \
 	apt-get install --no-install-recommends -y \
-	build-essential devscripts debhelper lintian fakeroot dpkg-dev
-
+	build-essential devscripts debhelper lintian fakeroot dpkg-dev autopkgtest
+{{ if .HostArch }}
+# Install cross toolchain.
+RUN {{ .CrossSources }}
+RUN dpkg --add-architecture {{ .HostArch }} && \
+	apt-get update && \
+	apt-get install --no-install-recommends -y \
+	crossbuild-essential-{{ .HostArch }}
+{{ end }}
 # Set working directory.
 WORKDIR {{ .SourceDir }}
 
@@ -46,15 +68,83 @@ WORKDIR {{ .SourceDir }}
 CMD ["sleep", "inf"]
 `
 
+const installTemplate = `
+# From which Docker image do we start?
+FROM %s
+
+# Set debconf to be non interactive.
+RUN echo 'debconf debconf/frontend select Noninteractive' | debconf-set-selections
+
+# Fetch package lists, customization may need them.
+RUN apt-get update
+
+# Sleep all the time and just wait for commands.
+CMD ["sleep", "inf"]
+`
+
+// Load function reads customization from files at given paths,
+// empty paths are skipped.
+func Load(templatePath, extraPath string) (Customization, error) {
+	custom := Customization{}
+
+	if templatePath != "" {
+		data, err := ioutil.ReadFile(templatePath)
+		if err != nil {
+			return custom, err
+		}
+
+		custom.Template = string(data)
+	}
+
+	if extraPath != "" {
+		data, err := ioutil.ReadFile(extraPath)
+		if err != nil {
+			return custom, err
+		}
+
+		custom.Extra = string(data)
+	}
+
+	return custom, nil
+}
+
+// Hash function returns short hash of customization,
+// so images built from different Dockerfiles can be told apart.
+//
+// Empty string is returned if there is no customization.
+func (custom Customization) Hash() string {
+	if custom.Template == "" && custom.Extra == "" {
+		return ""
+	}
+
+	checksum := sha256.Sum256([]byte(custom.Template + "\x00" + custom.Extra))
+
+	return hex.EncodeToString(checksum[:])[:8]
+}
+
 // Parse function returns ready to use template
-func Parse(repo, tag string) ([]byte, error) {
+//
+// If hostArch is not empty, cross toolchain for it is installed.
+//
+// User supplied template is used instead of built-in one
+// and extra snippet is appended, if customized.
+func Parse(from, hostArch string, custom Customization) ([]byte, error) {
 	t := Template{
-		Repo:      repo,
-		Tag:       tag,
+		From:      from,
 		SourceDir: naming.ContainerSourceDir,
+		HostArch:  hostArch,
+	}
+
+	if hostArch != "" {
+		t.CrossSources = CrossSources(hostArch)
+	}
+
+	text := dockerfileTemplate
+	if custom.Template != "" {
+		text = custom.Template
 	}
 
-	temp, err := template.New("dockerfile").Parse(dockerfileTemplate)
+	temp, err := template.New("dockerfile").Parse(text)
 	if err != nil {
 		return nil, err
 	}
@@ -65,5 +155,59 @@ func Parse(repo, tag string) ([]byte, error) {
 		return nil, err
 	}
 
+	if custom.Extra != "" {
+		buffer.WriteString("\n" + custom.Extra)
+	}
+
 	return buffer.Bytes(), nil
 }
+
+// CrossSources function returns shell command making packages
+// of given foreign architecture available to apt.
+//
+// Debian serves all architectures from the same mirrors, but Ubuntu keeps
+// other than amd64 and i386 on ports.ubuntu.com, so on Ubuntu existing sources
+// are restricted to native architecture and sources of host architecture
+// are added, in both one-line and deb822 format. Running it again does nothing.
+func CrossSources(hostArch string) string {
+	mirror := "http://ports.ubuntu.com/ubuntu-ports/"
+	if hostArch == "amd64" || hostArch == "i386" {
+		mirror = "http://archive.ubuntu.com/ubuntu/"
+	}
+
+	uri := `http://(archive|security|ports)\.ubuntu\.com/ubuntu(-ports)?/?`
+
+	return `. /etc/os-release; ` +
+		`cd /etc/apt/sources.list.d; ` +
+		`if [ "$ID" = ubuntu ] && [ ! -e ports.list ] && [ ! -e ports.sources ]; then ` +
+		`native=$(dpkg --print-architecture); ` +
+		`if [ -f ../sources.list ]; then ` +
+		`sed -i -E "s/^deb ([^[])/deb [arch=$native] \1/" ../sources.list && ` +
+		`grep "^deb \[arch=$native\]" ../sources.list | ` +
+		`sed -E -e "s/\[arch=$native\]/[arch=` + hostArch + `]/" -e "s#` + uri + `#` + mirror + `#" > ports.list; ` +
+		`fi; ` +
+		`if [ -f ubuntu.sources ]; then ` +
+		`sed -i "/^Architectures:/d; /^Types:/a Architectures: $native" ubuntu.sources && ` +
+		`sed -E -e "s/^Architectures: .*/Architectures: ` + hostArch + `/" -e "s#^URIs: .*#URIs: ` + mirror + `#" ubuntu.sources > ports.sources; ` +
+		`fi; ` +
+		`fi`
+}
+
+// ParseInstall function returns Dockerfile of minimal image
+// used for installation testing, with extra snippet appended if customized.
+//
+// User supplied template can't be used, as it's not known
+// which parts of it are needed for installation only.
+func ParseInstall(from string, custom Customization) ([]byte, error) {
+	if custom.Template != "" {
+		return nil, errors.New("installation can't be tested in image made from custom Dockerfile template")
+	}
+
+	dockerFile := fmt.Sprintf(installTemplate, from)
+
+	if custom.Extra != "" {
+		dockerFile += "\n" + custom.Extra
+	}
+
+	return []byte(dockerFile), nil
+}
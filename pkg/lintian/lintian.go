@@ -0,0 +1,177 @@
+// Package lintian includes lintian output parsing utilities
+package lintian
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// FailOnError constant makes only errors fail the check
+	FailOnError = "error"
+	// FailOnWarning constant makes errors and new warnings fail the check
+	FailOnWarning = "warning"
+	// FailOnNone constant makes check never fail
+	FailOnNone = "none"
+)
+
+// severities lists known tag severities in order of importance,
+// along with their names used in summary
+var severities = []struct {
+	Code string
+	Name string
+}{
+	{"E", "errors"},
+	{"W", "warnings"},
+	{"I", "info"},
+	{"P", "pedantic"},
+	{"X", "experimental"},
+	{"O", "overridden"},
+}
+
+// line matches tags like "W: pkg source: tag-name context"
+var line = regexp.MustCompile(`^([EWIPXO]): (\S+?)(?: (source|binary|udeb|changes|buildinfo))?: (\S+)(?: (.*))?$`)
+
+// Tag struct represents single tag emitted by lintian.
+type Tag struct {
+	Severity string `json:"severity"`
+	Name     string `json:"name"`
+	Package  string `json:"package"`
+	Type     string `json:"type,omitempty"`
+	Context  string `json:"context,omitempty"`
+}
+
+// Parse function reads tags from lintian output,
+// ignoring any other lines, like explanations.
+func Parse(reader io.Reader) ([]Tag, error) {
+	tags := make([]Tag, 0)
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		match := line.FindStringSubmatch(strings.TrimRight(scanner.Text(), "\r"))
+		if match == nil {
+			continue
+		}
+
+		tags = append(tags, Tag{
+			Severity: match[1],
+			Package:  match[2],
+			Type:     match[3],
+			Name:     match[4],
+			Context:  match[5],
+		})
+	}
+
+	return tags, scanner.Err()
+}
+
+// ParseFile function reads tags from file with lintian output.
+//
+// Non existent file is not an error, there are just no tags.
+func ParseFile(path string) ([]Tag, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []Tag{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Parse(file)
+}
+
+// Summary function returns tags grouped by severity and name,
+// with number of their occurrences.
+func Summary(tags []Tag) string {
+	builder := new(strings.Builder)
+
+	for _, severity := range severities {
+		counts := make(map[string]int)
+		for _, tag := range tags {
+			if tag.Severity == severity.Code {
+				counts[tag.Name]++
+			}
+		}
+
+		if len(counts) == 0 {
+			continue
+		}
+
+		names := make([]string, 0)
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(builder, "%s:\n", severity.Name)
+		for _, name := range names {
+			fmt.Fprintf(builder, "  %s: %s (%d)\n", severity.Code, name, counts[name])
+		}
+	}
+
+	return builder.String()
+}
+
+// Check function decides if tags are acceptable at given fail level.
+//
+// Errors fail at both error and warning levels. Warnings fail at warning level,
+// but only those not emitted for previous version of package, if known.
+// Previous tags being nil means there is no previous version.
+func Check(tags, previous []Tag, failOn string) error {
+	known := make(map[string]bool)
+	for _, tag := range previous {
+		known[tag.key()] = true
+	}
+
+	errs := 0
+	warnings := make([]string, 0)
+
+	for _, tag := range tags {
+		switch tag.Severity {
+		case "E":
+			errs++
+		case "W":
+			if !known[tag.key()] {
+				warnings = append(warnings, tag.Name)
+			}
+		}
+	}
+
+	switch failOn {
+	case FailOnNone:
+		return nil
+	case FailOnError:
+		warnings = nil
+	case FailOnWarning:
+	default:
+		return ValidateFailOn(failOn)
+	}
+
+	if errs == 0 && len(warnings) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("lintian reported %d error(s) and %d new warning(s)", errs, len(warnings))
+}
+
+// ValidateFailOn function checks if given fail level is known.
+func ValidateFailOn(failOn string) error {
+	switch failOn {
+	case FailOnError, FailOnWarning, FailOnNone:
+		return nil
+	}
+
+	return fmt.Errorf("--fail-on must be one of %s, %s or %s", FailOnError, FailOnWarning, FailOnNone)
+}
+
+// key identifies tag across package versions,
+// as context often contains version specific paths.
+func (tag Tag) key() string {
+	return tag.Severity + " " + tag.Package + " " + tag.Name
+}
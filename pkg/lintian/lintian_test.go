@@ -0,0 +1,64 @@
+package lintian_test
+
+import (
+	"github.com/dawidd6/deber/pkg/lintian"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const output = `E: pkg: bad-distribution-in-changes-file unstable
+W: pkg source: out-of-date-standards-version 4.1.0 (released 2017-08-13) (current is 4.6.2)
+N:
+N:   The source package refers to a Standards-Version older than the one
+N:   that was current at the time the package was created.
+N:
+W: pkg-doc: extended-description-line-too-long
+I: pkg: spelling-error-in-binary usr/bin/pkg teh the
+O: pkg: hardening-no-fortify-functions [usr/bin/pkg]
+`
+
+func TestParse(t *testing.T) {
+	tags, err := lintian.Parse(strings.NewReader(output))
+	assert.NoError(t, err)
+	assert.Len(t, tags, 5)
+
+	assert.Equal(t, lintian.Tag{
+		Severity: "W",
+		Name:     "out-of-date-standards-version",
+		Package:  "pkg",
+		Type:     "source",
+		Context:  "4.1.0 (released 2017-08-13) (current is 4.6.2)",
+	}, tags[1])
+
+	assert.Equal(t, lintian.Tag{
+		Severity: "W",
+		Name:     "extended-description-line-too-long",
+		Package:  "pkg-doc",
+	}, tags[2])
+}
+
+func TestSummary(t *testing.T) {
+	tags, err := lintian.Parse(strings.NewReader(output))
+	assert.NoError(t, err)
+
+	summary := lintian.Summary(tags)
+	assert.Contains(t, summary, "errors:\n  E: bad-distribution-in-changes-file (1)\n")
+	assert.Contains(t, summary, "overridden:\n  O: hardening-no-fortify-functions (1)\n")
+}
+
+func TestCheck(t *testing.T) {
+	tags, err := lintian.Parse(strings.NewReader(output))
+	assert.NoError(t, err)
+
+	warnings := tags[1:]
+	previous := tags[1:2]
+
+	assert.Error(t, lintian.Check(tags, nil, lintian.FailOnError))
+	assert.NoError(t, lintian.Check(tags, nil, lintian.FailOnNone))
+	assert.NoError(t, lintian.Check(warnings, nil, lintian.FailOnError))
+	assert.Error(t, lintian.Check(warnings, nil, lintian.FailOnWarning))
+	assert.Error(t, lintian.Check(warnings, previous, lintian.FailOnWarning))
+	assert.NoError(t, lintian.Check(warnings, warnings, lintian.FailOnWarning))
+	assert.Error(t, lintian.Check(tags, nil, "sometimes"))
+}
@@ -0,0 +1,125 @@
+// Package lock includes inter-process file locking utilities
+package lock
+
+import (
+	"fmt"
+	"github.com/dawidd6/deber/pkg/log"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Lock struct represents exclusive lock held on file.
+type Lock struct {
+	file *os.File
+}
+
+// Acquire function takes exclusive lock on file at given path,
+// making it and its parent directories if needed.
+//
+// If lock is held by another process, it informs about
+// waiting for it and blocks until it's released.
+func Acquire(path string) (*Lock, error) {
+	return acquire(path, true)
+}
+
+// TryAcquire function takes exclusive lock on file at given path
+// like Acquire does, but fails instead of waiting if it's held by another process.
+func TryAcquire(path string) (*Lock, error) {
+	return acquire(path, false)
+}
+
+// acquire function takes lock on file at given path,
+// waiting for it if asked to.
+//
+// Lock file may get removed by holder of the lock, while it's being waited for.
+// Lock taken on such file guards nothing, so it's dropped and taken again.
+func acquire(path string, wait bool) (*Lock, error) {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == syscall.EWOULDBLOCK {
+			if !wait {
+				file.Close()
+				return nil, fmt.Errorf("lock %s is held by another process", path)
+			}
+
+			log.Drop()
+			log.ExtraInfo("waiting for lock " + path)
+
+			err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+			log.Drop()
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		same, err := isCurrent(file, path)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		if same {
+			return &Lock{file: file}, nil
+		}
+
+		file.Close()
+	}
+}
+
+// isCurrent function checks if given open file
+// is still the one at given path.
+func isCurrent(file *os.File, path string) (bool, error) {
+	opened, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	current, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return os.SameFile(opened, current), nil
+}
+
+// Release function releases lock.
+//
+// Lock file is left in place, use Remove to get rid of it.
+func (lock *Lock) Release() error {
+	err := syscall.Flock(int(lock.file.Fd()), syscall.LOCK_UN)
+	if err != nil {
+		lock.file.Close()
+		return err
+	}
+
+	return lock.file.Close()
+}
+
+// Remove function removes lock file and releases lock.
+//
+// Processes waiting for the lock notice that file is gone
+// and take lock on a new one instead.
+func (lock *Lock) Remove() error {
+	err := os.Remove(lock.file.Name())
+	if err != nil {
+		lock.Release()
+		return err
+	}
+
+	return lock.Release()
+}
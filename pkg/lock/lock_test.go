@@ -0,0 +1,78 @@
+package lock_test
+
+import (
+	"github.com/dawidd6/deber/pkg/lock"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sub", "test.lock")
+
+	first, err := lock.Acquire(path)
+	assert.NoError(t, err)
+
+	acquired := make(chan *lock.Lock)
+	go func() {
+		second, err := lock.Acquire(path)
+		assert.NoError(t, err)
+		acquired <- second
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.NoError(t, first.Release())
+
+	second := <-acquired
+	assert.NoError(t, second.Release())
+}
+
+func TestRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.lock")
+
+	first, err := lock.Acquire(path)
+	assert.NoError(t, err)
+
+	_, err = lock.TryAcquire(path)
+	assert.Error(t, err)
+
+	acquired := make(chan *lock.Lock)
+	go func() {
+		second, err := lock.Acquire(path)
+		assert.NoError(t, err)
+		acquired <- second
+	}()
+
+	// Let the other one wait on file being removed
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, first.Remove())
+
+	// Waiting one gets lock on new file, which excludes others
+	second := <-acquired
+	assert.FileExists(t, path)
+
+	_, err = lock.TryAcquire(path)
+	assert.Error(t, err)
+
+	assert.NoError(t, second.Release())
+
+	third, err := lock.TryAcquire(path)
+	assert.NoError(t, err)
+	assert.NoError(t, third.Release())
+}
@@ -3,8 +3,21 @@ package log
 
 import (
 	"fmt"
+	"github.com/docker/docker/pkg/term"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
+)
+
+const (
+	// StatusDone constant represents successfully finished step
+	StatusDone = "done"
+	// StatusSkipped constant represents skipped step
+	StatusSkipped = "skipped"
+	// StatusFailed constant represents failed step
+	StatusFailed = "failed"
 )
 
 const (
@@ -12,82 +25,331 @@ const (
 	blue   = "\033[0;34m"
 	red    = "\033[0;31m"
 	normal = "\033[0m"
+
+	timestampFormat = "15:04:05"
 )
 
-var (
-	// NoColor controls if log will be colored or not
-	NoColor bool
+// Level type represents verbosity of logger.
+type Level int
+
+const (
+	// LevelQuiet constant makes logger print only errors
+	LevelQuiet Level = iota
+	// LevelNormal constant makes logger print steps and commands output
+	LevelNormal
+	// LevelVerbose constant makes logger print executed commands too
+	LevelVerbose
+	// LevelDebug constant makes logger print everything
+	LevelDebug
+)
+
+// Logger interface represents what is needed to report progress of steps.
+type Logger interface {
+	// Info prints step description, waiting for its status
+	Info(info string)
+	// ExtraInfo prints indented sub-step description, waiting for its status
+	ExtraInfo(info string)
+	// Verbose prints line in verbose mode
+	Verbose(info string)
+	// Debug prints line in debug mode
+	Debug(info string)
+	// Error prints given error
+	Error(err error)
+	// Drop prints new line if needed
+	Drop()
+	// Skipped prints 'skipped' status
+	Skipped() error
+	// Done prints 'done' status
+	Done() error
+	// Failed prints 'failed' status and returns given error
+	Failed(err error) error
+	// Status returns the last printed status of current step
+	Status() string
+	// Writer returns where output of executed commands should go
+	Writer() io.Writer
+}
+
+// Options struct represents configuration of Log.
+type Options struct {
 	// Prefix is the program name, will be outputted before info messages
-	Prefix  string
+	Prefix string
+	// Level controls how much is printed
+	Level Level
+	// NoColor controls if output will be colored or not,
+	// color is disabled anyway if output is not a terminal
+	NoColor bool
+	// Timestamps controls if messages are prefixed with time
+	Timestamps bool
+}
+
+// Log struct is the default implementation of Logger.
+//
+// It prints to output and optionally tees everything,
+// regardless of level and without colors, to a file.
+type Log struct {
+	options Options
+	output  io.Writer
+	color   bool
+	file    *os.File
 	dropped bool
-)
+	status  string
+}
+
+var std Logger = New(os.Stdout, Options{
+	Prefix: filepath.Base(os.Args[0]),
+	Level:  LevelNormal,
+})
+
+// New function creates Log printing to given output.
+func New(output io.Writer, options Options) *Log {
+	log := &Log{
+		options: options,
+		dropped: true,
+	}
+	log.SetOutput(output)
+
+	return log
+}
+
+// SetDefault function replaces logger used by package level functions.
+func SetDefault(logger Logger) {
+	std = logger
+}
+
+// SetOutput function changes where log is printed.
+func (log *Log) SetOutput(output io.Writer) {
+	log.output = output
+	log.color = false
+
+	if file, ok := output.(*os.File); ok && !log.options.NoColor {
+		log.color = term.IsTerminal(file.Fd())
+	}
+}
+
+// Tee function makes log write everything to file at given path too,
+// making parent directories if needed.
+func (log *Log) Tee(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	log.Close()
+	log.file = file
+
+	return nil
+}
+
+// Close function stops writing log to file.
+func (log *Log) Close() error {
+	if log.file == nil {
+		return nil
+	}
+
+	err := log.file.Close()
+	log.file = nil
+
+	return err
+}
+
+// print writes plain text to file and colored (if enabled) text to output,
+// but only if level is high enough.
+func (log *Log) print(level Level, plain, colored string) {
+	if log.file != nil {
+		fmt.Fprint(log.file, plain)
+	}
+
+	if level > log.options.Level {
+		return
+	}
+
+	if log.color {
+		fmt.Fprint(log.output, colored)
+	} else {
+		fmt.Fprint(log.output, plain)
+	}
+}
+
+// printf prints prefixed message of given kind.
+func (log *Log) printf(level Level, color, kind, format string, args ...interface{}) {
+	prefix := fmt.Sprintf("%s:%s:", log.options.Prefix, kind)
+	if log.options.Timestamps {
+		prefix = time.Now().Format(timestampFormat) + " " + prefix
+	}
 
-func init() {
-	Prefix = filepath.Base(os.Args[0])
+	message := fmt.Sprintf(format, args...)
+	log.print(level, prefix+" "+message, color+prefix+normal+" "+message)
 }
 
 // Drop function prints new line
-func Drop() {
-	if dropped {
+func (log *Log) Drop() {
+	if log.dropped {
 		return
 	}
 
-	dropped = true
-	fmt.Println()
+	log.dropped = true
+	log.print(LevelNormal, "\n", "\n")
 }
 
 // Info function prints given string
-func Info(info string) {
-	dropped = false
+//
+// New step begins, so status of previous one is forgotten.
+func (log *Log) Info(info string) {
+	log.dropped = false
+	log.status = ""
+	log.printf(LevelNormal, blue, "info", "%s ...", info)
+}
 
-	if NoColor {
-		fmt.Printf("%s:info: %s ...", Prefix, info)
-	} else {
-		fmt.Printf("%s%s:info:%s %s ...", blue, Prefix, normal, info)
+// ExtraInfo prints given info with indent and without colors or prefix
+func (log *Log) ExtraInfo(info string) {
+	log.dropped = false
+	text := fmt.Sprintf("  %s ...", info)
+	log.print(LevelNormal, text, text)
+}
+
+// Verbose function prints given string in verbose mode
+func (log *Log) Verbose(info string) {
+	if log.options.Level >= LevelVerbose {
+		log.Drop()
 	}
+
+	log.printf(LevelVerbose, cyan, "verbose", "%s\n", info)
 }
 
-// Error function prints given error
-func Error(err error) {
-	if NoColor {
-		fmt.Printf("%s:error: %s\n", Prefix, err)
-	} else {
-		fmt.Printf("%s%s:error:%s %s\n", red, Prefix, normal, err)
+// Debug function prints given string in debug mode
+func (log *Log) Debug(info string) {
+	if log.options.Level >= LevelDebug {
+		log.Drop()
 	}
+
+	log.printf(LevelDebug, cyan, "debug", "%s\n", info)
 }
 
-// ExtraInfo prints given info with indent and without colors or prefix
-func ExtraInfo(info string) {
-	dropped = false
-	fmt.Printf("  %s ...", info)
+// Error function prints given error
+func (log *Log) Error(err error) {
+	log.Drop()
+	log.printf(LevelQuiet, red, "error", "%s\n", err)
 }
 
 // Skipped function prints 'skipped' and new line
-func Skipped() error {
-	if !dropped {
-		fmt.Printf("%s", "skipped")
-		Drop()
+func (log *Log) Skipped() error {
+	log.status = StatusSkipped
+
+	if !log.dropped {
+		log.print(LevelNormal, StatusSkipped, StatusSkipped)
+		log.Drop()
 	}
 
 	return nil
 }
 
 // Done function prints 'done' and new line
-func Done() error {
-	if !dropped {
-		fmt.Printf("%s", "done")
-		Drop()
+func (log *Log) Done() error {
+	log.status = StatusDone
+
+	if !log.dropped {
+		log.print(LevelNormal, StatusDone, StatusDone)
+		log.Drop()
 	}
 
 	return nil
 }
 
 // Failed function prints 'failed' and new line
-func Failed(err error) error {
-	if !dropped {
-		fmt.Printf("%s", "failed")
-		Drop()
+func (log *Log) Failed(err error) error {
+	log.status = StatusFailed
+
+	if !log.dropped {
+		log.print(LevelNormal, StatusFailed, StatusFailed)
+		log.Drop()
 	}
 
 	return err
 }
+
+// Status function returns what was printed by
+// the last call to Skipped, Done or Failed since the last Info.
+func (log *Log) Status() string {
+	return log.status
+}
+
+// Writer function returns where output of executed commands should go,
+// that is output (unless quiet) and file (if any).
+func (log *Log) Writer() io.Writer {
+	writers := make([]io.Writer, 0)
+
+	if log.options.Level >= LevelNormal {
+		writers = append(writers, log.output)
+	}
+
+	if log.file != nil {
+		writers = append(writers, log.file)
+	}
+
+	if len(writers) == 0 {
+		return ioutil.Discard
+	}
+
+	return io.MultiWriter(writers...)
+}
+
+// Drop function prints new line
+func Drop() {
+	std.Drop()
+}
+
+// Info function prints given string
+func Info(info string) {
+	std.Info(info)
+}
+
+// ExtraInfo prints given info with indent and without colors or prefix
+func ExtraInfo(info string) {
+	std.ExtraInfo(info)
+}
+
+// Verbose function prints given string in verbose mode
+func Verbose(info string) {
+	std.Verbose(info)
+}
+
+// Debug function prints given string in debug mode
+func Debug(info string) {
+	std.Debug(info)
+}
+
+// Error function prints given error
+func Error(err error) {
+	std.Error(err)
+}
+
+// Skipped function prints 'skipped' and new line
+func Skipped() error {
+	return std.Skipped()
+}
+
+// Done function prints 'done' and new line
+func Done() error {
+	return std.Done()
+}
+
+// Failed function prints 'failed' and new line
+func Failed(err error) error {
+	return std.Failed(err)
+}
+
+// Status function returns what was printed by
+// the last call to Skipped, Done or Failed.
+func Status() string {
+	return std.Status()
+}
+
+// Writer function returns where output of executed commands should go.
+func Writer() io.Writer {
+	return std.Writer()
+}
@@ -3,6 +3,7 @@ package naming
 
 import (
 	"fmt"
+	"github.com/dawidd6/deber/pkg/arch"
 	"path/filepath"
 	"strings"
 )
@@ -20,6 +21,27 @@ const (
 	// ContainerCacheDir constant represents where on container will
 	// cache directory be mounted
 	ContainerCacheDir = "/var/cache/apt"
+	// ContainerRepoDir constant represents where on container will
+	// archive target directory be mounted as local repository
+	ContainerRepoDir = "/repo"
+	// ContainerAutopkgtestDir constant represents where on container
+	// autopkgtest results are stored
+	ContainerAutopkgtestDir = "/build/autopkgtest"
+	// ContainerPreviousDir constant represents where on install test
+	// container will previously archived version be mounted
+	ContainerPreviousDir = "/previous"
+)
+
+const (
+	// LabelDockerfile constant represents image label holding
+	// hash of Dockerfile the image was built from
+	LabelDockerfile = "deber.dockerfile"
+	// LabelParent constant represents image label holding
+	// digest of parent image the image was built from
+	LabelParent = "deber.parent"
+	// LabelParentImage constant represents image label holding
+	// reference of parent image the image was built from
+	LabelParentImage = "deber.parent.image"
 )
 
 // Naming struct holds various information naming information
@@ -30,8 +52,14 @@ type Naming struct {
 
 	// Container name
 	Container string
+	// InstallContainer is the name of fresh container
+	// used for installation testing
+	InstallContainer string
 	// Image name
 	Image string
+	// InstallImage is the name of minimal image
+	// used for installation testing
+	InstallImage string
 
 	// SourceDir is an absolute path where source lives
 	SourceDir string
@@ -39,8 +67,34 @@ type Naming struct {
 	SourceParentDir string
 	// BuildDir is an absolute path where build artifacts are stored
 	BuildDir string
+	// LogFile is an absolute path where build log is written
+	LogFile string
+	// BuildLogFile is an absolute path where output of commands
+	// executed in container is written, like sbuild does
+	BuildLogFile string
+	// AutopkgtestDir is an absolute path where autopkgtest results are stored
+	AutopkgtestDir string
+	// LintianFile is an absolute path where lintian output is written
+	LintianFile string
+	// ChangesFile is an absolute path of .changes file
+	// describing build including architecture dependent packages
+	ChangesFile string
+	// IndepChangesFile is an absolute path of .changes file
+	// describing build of architecture independent packages only
+	IndepChangesFile string
+	// SourceChangesFile is an absolute path of .changes file
+	// describing source-only build
+	SourceChangesFile string
 	// CacheDir is an absolute path where apt cache is stored
 	CacheDir string
+
+	// ContainerLock is an absolute path of lock file guarding container
+	ContainerLock string
+	// CacheLock is an absolute path of lock file guarding apt cache
+	CacheLock string
+	// ArchiveLock is an absolute path of lock file guarding archive target directory
+	ArchiveLock string
+
 	// ArchiveDir is an absolute path where
 	// all built packages are stored
 	ArchiveDir string
@@ -68,6 +122,15 @@ type Args struct {
 	Upstream string
 	// Target is the target distribution the package is building for
 	Target string
+	// Arch is the architecture the package is building on,
+	// empty means native one
+	Arch string
+	// HostArch is the architecture the package is cross-building for,
+	// empty means no cross-building
+	HostArch string
+	// Customization is the hash of user supplied Dockerfile changes,
+	// empty means no changes
+	Customization string
 
 	// SourceBaseDir is a directory where source lives
 	SourceBaseDir string
@@ -83,27 +146,80 @@ type Args struct {
 func New(args Args) *Naming {
 	args.Target = standardizeTarget(args.Version, args.Target)
 
+	args.HostArch = standardizeHostArch(args.Arch, args.HostArch)
+
+	tag := standardizeTag(args.Target, args.Arch, args.HostArch)
+	if args.Customization != "" {
+		tag = tag + "-" + args.Customization
+	}
 	version := standardizeVersion(args.Version)
-	image := fmt.Sprintf("%s:%s", args.Prefix, args.Target)
-	container := fmt.Sprintf("%s_%s_%s_%s", args.Prefix, args.Target, args.Source, version)
+	image := fmt.Sprintf("%s:%s", args.Prefix, tag)
+	container := fmt.Sprintf("%s_%s_%s_%s", args.Prefix, tag, args.Source, version)
+
+	buildLog := fmt.Sprintf("%s_%s_%s.build", args.Source, stripEpoch(args.Version), standardizeBuildLogArch(args.Arch, args.HostArch))
+	changes := fmt.Sprintf("%s_%s_%%s.changes", args.Source, stripEpoch(args.Version))
+
+	// Cross-built packages are archived along natively built ones
+	archiveTag := standardizeTag(args.Target, args.Arch, "")
+	if args.HostArch != "" {
+		archiveTag = standardizeTag(args.Target, args.HostArch, "")
+	}
 
 	return &Naming{
 		Args: args,
 
-		Container: container,
-		Image:     image,
+		Container:        container,
+		InstallContainer: container + "-install",
+		Image:            image,
+		InstallImage:     image + "-install",
 
 		SourceDir:         args.SourceBaseDir,
 		SourceParentDir:   filepath.Dir(args.SourceBaseDir),
 		BuildDir:          filepath.Join(args.BuildBaseDir, container),
+		LogFile:           filepath.Join(args.BuildBaseDir, container, args.Prefix+".log"),
+		BuildLogFile:      filepath.Join(args.BuildBaseDir, container, buildLog),
+		AutopkgtestDir:    filepath.Join(args.BuildBaseDir, container, "autopkgtest"),
+		LintianFile:       filepath.Join(args.BuildBaseDir, container, "lintian.txt"),
+		ChangesFile:       filepath.Join(args.BuildBaseDir, container, fmt.Sprintf(changes, standardizeBuildLogArch(args.Arch, args.HostArch))),
+		IndepChangesFile:  filepath.Join(args.BuildBaseDir, container, fmt.Sprintf(changes, "all")),
+		SourceChangesFile: filepath.Join(args.BuildBaseDir, container, fmt.Sprintf(changes, "source")),
 		CacheDir:          filepath.Join(args.CacheBaseDir, image),
+		ContainerLock:     filepath.Join(args.BuildBaseDir, container+".lock"),
+		CacheLock:         filepath.Join(args.CacheBaseDir, image+".lock"),
+		ArchiveLock:       filepath.Join(args.ArchiveBaseDir, archiveTag+".lock"),
 		ArchiveDir:        args.ArchiveBaseDir,
-		ArchiveTargetDir:  filepath.Join(args.ArchiveBaseDir, args.Target),
-		ArchiveSourceDir:  filepath.Join(args.ArchiveBaseDir, args.Target, args.Source),
-		ArchiveVersionDir: filepath.Join(args.ArchiveBaseDir, args.Target, args.Source, args.Version),
+		ArchiveTargetDir:  filepath.Join(args.ArchiveBaseDir, archiveTag),
+		ArchiveSourceDir:  filepath.Join(args.ArchiveBaseDir, archiveTag, args.Source),
+		ArchiveVersionDir: filepath.Join(args.ArchiveBaseDir, archiveTag, args.Source, args.Version),
 	}
 }
 
+// ParseContainer function splits container name made by New
+// into tag (target with optional architecture), source and version parts.
+func ParseContainer(prefix, name string) (tag, source, version string, err error) {
+	if !strings.HasPrefix(name, prefix+"_") {
+		return "", "", "", fmt.Errorf("container %s doesn't start with %s_", name, prefix)
+	}
+
+	// Neither of these parts can contain underscores
+	parts := strings.Split(strings.TrimPrefix(name, prefix+"_"), "_")
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("container %s is not named properly", name)
+	}
+
+	return parts[0], parts[1], parts[2], nil
+}
+
+// ParseImage function extracts tag (target with optional architecture)
+// from image name made by New.
+func ParseImage(prefix, name string) (tag string, err error) {
+	if !strings.HasPrefix(name, prefix+":") {
+		return "", fmt.Errorf("image %s doesn't start with %s:", name, prefix)
+	}
+
+	return strings.TrimPrefix(name, prefix+":"), nil
+}
+
 func standardizeVersion(version string) string {
 	// Docker allows only [a-zA-Z0-9][a-zA-Z0-9_.-]
 	// and Debian package versioning allows these characters
@@ -114,6 +230,25 @@ func standardizeVersion(version string) string {
 	return version
 }
 
+func stripEpoch(version string) string {
+	// Epoch is not a part of file names
+	parts := strings.SplitN(version, ":", 2)
+
+	return parts[len(parts)-1]
+}
+
+func standardizeBuildLogArch(buildArch, hostArch string) string {
+	if hostArch != "" {
+		return hostArch
+	}
+
+	if buildArch != "" {
+		return buildArch
+	}
+
+	return arch.Native()
+}
+
 func standardizeTarget(version, target string) string {
 	// UNRELEASED == unstable
 	target = strings.Replace(target, "UNRELEASED", "unstable", -1)
@@ -126,3 +261,29 @@ func standardizeTarget(version, target string) string {
 
 	return target
 }
+
+func standardizeTag(target, buildArch, hostArch string) string {
+	// Native builds keep plain target for compatibility
+	if buildArch != "" {
+		target = target + "-" + buildArch
+	}
+
+	if hostArch != "" {
+		target = target + "-cross-" + hostArch
+	}
+
+	return target
+}
+
+func standardizeHostArch(buildArch, hostArch string) string {
+	if buildArch == "" {
+		buildArch = arch.Native()
+	}
+
+	// Cross-building for the same architecture is a native build
+	if hostArch == buildArch {
+		return ""
+	}
+
+	return hostArch
+}
@@ -0,0 +1,126 @@
+package naming_test
+
+import (
+	"github.com/dawidd6/deber/pkg/naming"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewNative(t *testing.T) {
+	n := naming.New(naming.Args{
+		Prefix:         "deber",
+		Source:         "pkg",
+		Version:        "1:1.0~rc1-1",
+		Upstream:       "1.0~rc1",
+		Target:         "UNRELEASED",
+		BuildBaseDir:   "/tmp",
+		CacheBaseDir:   "/tmp",
+		ArchiveBaseDir: "/home/user/deber",
+	})
+
+	assert.Equal(t, "deber:unstable", n.Image)
+	assert.Equal(t, "deber_unstable_pkg_1-1.0-rc1-1", n.Container)
+	assert.Equal(t, "deber_unstable_pkg_1-1.0-rc1-1-install", n.InstallContainer)
+	assert.Equal(t, "/tmp/deber_unstable_pkg_1-1.0-rc1-1", n.BuildDir)
+	assert.Equal(t, "/tmp/deber_unstable_pkg_1-1.0-rc1-1/deber.log", n.LogFile)
+	assert.Equal(t, "/tmp/deber_unstable_pkg_1-1.0-rc1-1/lintian.txt", n.LintianFile)
+	assert.Equal(t, "/home/user/deber/unstable/pkg/1:1.0~rc1-1", n.ArchiveVersionDir)
+}
+
+func TestNewArch(t *testing.T) {
+	n := naming.New(naming.Args{
+		Prefix:         "deber",
+		Source:         "pkg",
+		Version:        "1.0-1~bpo10+1",
+		Upstream:       "1.0",
+		Target:         "buster-backports",
+		Arch:           "arm64",
+		BuildBaseDir:   "/tmp",
+		CacheBaseDir:   "/tmp",
+		ArchiveBaseDir: "/home/user/deber",
+	})
+
+	assert.Equal(t, "deber:buster-backports-arm64", n.Image)
+	assert.Equal(t, "deber_buster-backports-arm64_pkg_1.0-1-bpo10-1", n.Container)
+	assert.Equal(t, "/tmp/deber:buster-backports-arm64", n.CacheDir)
+	assert.Equal(t, "/home/user/deber/buster-backports-arm64", n.ArchiveTargetDir)
+	assert.Equal(t, "/tmp/deber_buster-backports-arm64_pkg_1.0-1-bpo10-1/pkg_1.0-1~bpo10+1_arm64.build", n.BuildLogFile)
+}
+
+func TestNewCross(t *testing.T) {
+	n := naming.New(naming.Args{
+		Prefix:         "deber",
+		Source:         "pkg",
+		Version:        "1.0-1",
+		Upstream:       "1.0",
+		Target:         "bookworm",
+		Arch:           "amd64",
+		HostArch:       "armhf",
+		BuildBaseDir:   "/tmp",
+		CacheBaseDir:   "/tmp",
+		ArchiveBaseDir: "/home/user/deber",
+	})
+
+	assert.Equal(t, "armhf", n.HostArch)
+	assert.Equal(t, "deber:bookworm-amd64-cross-armhf", n.Image)
+	assert.Equal(t, "deber_bookworm-amd64-cross-armhf_pkg_1.0-1", n.Container)
+	assert.Equal(t, "/home/user/deber/bookworm-armhf/pkg/1.0-1", n.ArchiveVersionDir)
+	assert.Equal(t, "/tmp/deber_bookworm-amd64-cross-armhf_pkg_1.0-1/pkg_1.0-1_armhf.build", n.BuildLogFile)
+	assert.Equal(t, "/tmp/deber_bookworm-amd64-cross-armhf_pkg_1.0-1/pkg_1.0-1_armhf.changes", n.ChangesFile)
+	assert.Equal(t, "/tmp/deber_bookworm-amd64-cross-armhf_pkg_1.0-1/pkg_1.0-1_source.changes", n.SourceChangesFile)
+}
+
+func TestNewCrossSameArch(t *testing.T) {
+	n := naming.New(naming.Args{
+		Prefix:   "deber",
+		Source:   "pkg",
+		Version:  "1.0-1",
+		Upstream: "1.0",
+		Target:   "bookworm",
+		Arch:     "arm64",
+		HostArch: "arm64",
+	})
+
+	assert.Empty(t, n.HostArch)
+	assert.Equal(t, "deber:bookworm-arm64", n.Image)
+	assert.Equal(t, "deber:bookworm-arm64-install", n.InstallImage)
+}
+
+func TestParseContainer(t *testing.T) {
+	tag, source, version, err := naming.ParseContainer("deber", "deber_bookworm-arm64_pkg_1-1.0-rc1-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "bookworm-arm64", tag)
+	assert.Equal(t, "pkg", source)
+	assert.Equal(t, "1-1.0-rc1-1", version)
+
+	_, _, _, err = naming.ParseContainer("deber", "other_bookworm_pkg_1.0-1")
+	assert.Error(t, err)
+
+	_, _, _, err = naming.ParseContainer("deber", "deber_bookworm_pkg")
+	assert.Error(t, err)
+}
+
+func TestParseImage(t *testing.T) {
+	tag, err := naming.ParseImage("deber", "deber:unstable")
+	assert.NoError(t, err)
+	assert.Equal(t, "unstable", tag)
+
+	_, err = naming.ParseImage("deber", "debian:unstable")
+	assert.Error(t, err)
+}
+
+func TestNewCustomization(t *testing.T) {
+	n := naming.New(naming.Args{
+		Prefix:         "deber",
+		Source:         "pkg",
+		Version:        "1.0-1",
+		Upstream:       "1.0",
+		Target:         "bookworm",
+		Customization:  "0123abcd",
+		ArchiveBaseDir: "/home/user/deber",
+	})
+
+	assert.Equal(t, "deber:bookworm-0123abcd", n.Image)
+	assert.Equal(t, "deber_bookworm-0123abcd_pkg_1.0-1", n.Container)
+	assert.Equal(t, "/home/user/deber/bookworm/pkg/1.0-1", n.ArchiveVersionDir)
+}
@@ -0,0 +1,315 @@
+// Package registry includes Docker Registry HTTP API v2 client
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHost constant is the host of DockerHub registry
+	DefaultHost = "registry-1.docker.io"
+	// Timeout constant limits time of single request, so unreachable
+	// registry doesn't hang the build
+	Timeout = 30 * time.Second
+)
+
+// Client struct represents connection to single registry.
+type Client struct {
+	base   *url.URL
+	client *http.Client
+	tokens map[string]string
+}
+
+// tagList struct represents JSON object received from
+// registry after querying it for list of tags for particular repository.
+type tagList struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// tokenResponse struct represents JSON object received from
+// token server.
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+// New function creates client of registry at given host.
+//
+// Host can be prefixed with scheme, HTTPS is used by default.
+func New(host string) (*Client, error) {
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+
+	base, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		base:   base,
+		client: &http.Client{Timeout: Timeout},
+		tokens: make(map[string]string),
+	}, nil
+}
+
+// Tags function queries registry for a list of all
+// available tags of given repository, following pagination.
+//
+// Official DockerHub repositories can be given without "library/" prefix.
+func (client *Client) Tags(name string) ([]string, error) {
+	if client.base.Host == DefaultHost && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+
+	tags := make([]string, 0)
+	next := client.base.ResolveReference(&url.URL{Path: fmt.Sprintf("/v2/%s/tags/list", name)})
+
+	for next != nil {
+		response, err := client.get(next, name)
+		if err != nil {
+			return nil, err
+		}
+
+		list := new(tagList)
+		err = decode(response, list)
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, list.Tags...)
+
+		next, err = nextPage(next, response.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+// Reference function returns name of given repository, under which
+// Docker Engine can pull it from this registry.
+//
+// Repositories from DockerHub and already containing
+// registry host are returned as they are.
+func (client *Client) Reference(repo string) string {
+	if client.base.Host == DefaultHost || HasHost(repo) {
+		return repo
+	}
+
+	return client.base.Host + "/" + repo
+}
+
+// HasHost function checks if given repository name
+// starts with registry host, like Docker Engine does.
+func HasHost(repo string) bool {
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	return strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost"
+}
+
+// MatchRepo function returns repo which has the given tag.
+//
+// Repos that can't be queried don't stop the search,
+// their errors are returned only if no repo matched.
+func (client *Client) MatchRepo(repos []string, tag string) (string, error) {
+	errs := make([]string, 0)
+
+	for _, repo := range repos {
+		tags, err := client.Tags(repo)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", repo, err))
+			continue
+		}
+
+		for _, t := range tags {
+			if t == tag {
+				return repo, nil
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return "", fmt.Errorf("couldn't match tag with repo (%s)", strings.Join(errs, "; "))
+	}
+
+	return "", errors.New("couldn't match tag with repo")
+}
+
+// get sends GET request to given URL, authenticating with bearer token
+// for given repository if registry asks for it.
+func (client *Client) get(u *url.URL, name string) (*http.Response, error) {
+	response, err := client.do(u, client.tokens[name])
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusUnauthorized {
+		return response, nil
+	}
+
+	challenge := response.Header.Get("WWW-Authenticate")
+	response.Body.Close()
+
+	token, err := client.token(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	client.tokens[name] = token
+
+	return client.do(u, token)
+}
+
+// do sends GET request to given URL with optional bearer token.
+func (client *Client) do(u *url.URL, token string) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return client.client.Do(request)
+}
+
+// token requests anonymous bearer token from server
+// described in WWW-Authenticate challenge.
+func (client *Client) token(challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("unsupported authentication challenge: %q", challenge)
+	}
+
+	params := parseChallenge(strings.TrimPrefix(challenge, "Bearer "))
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid authentication realm: %q", params["realm"])
+	}
+
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	response, err := client.do(realm, "")
+	if err != nil {
+		return "", err
+	}
+
+	t := new(tokenResponse)
+	err = decode(response, t)
+	if err != nil {
+		return "", err
+	}
+
+	if t.Token != "" {
+		return t.Token, nil
+	}
+
+	if t.AccessToken != "" {
+		return t.AccessToken, nil
+	}
+
+	return "", errors.New("no token received from " + realm.Host)
+}
+
+// decode reads JSON body of successful response into v.
+func decode(response *http.Response, v interface{}) error {
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", response.Request.URL, response.Status)
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// parseChallenge splits comma separated key="value" pairs
+// of WWW-Authenticate header.
+func parseChallenge(challenge string) map[string]string {
+	params := make(map[string]string)
+
+	for challenge != "" {
+		parts := strings.SplitN(challenge, "=", 2)
+		if len(parts) != 2 {
+			break
+		}
+
+		key := strings.TrimSpace(parts[0])
+		rest := strings.TrimSpace(parts[1])
+		value := ""
+
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			value = rest[1 : end+1]
+			rest = rest[end+2:]
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				end = len(rest)
+			}
+			value = rest[:end]
+			rest = rest[end:]
+		}
+
+		params[strings.ToLower(key)] = value
+		challenge = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+
+	return params
+}
+
+// nextPage returns URL of next page from Link header,
+// or nil if there is none.
+func nextPage(current *url.URL, link string) (*url.URL, error) {
+	for _, entry := range strings.Split(link, ",") {
+		parts := strings.Split(entry, ";")
+		target := strings.TrimSpace(parts[0])
+
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			param = strings.Replace(strings.TrimSpace(param), " ", "", -1)
+			if param != `rel="next"` && param != "rel=next" {
+				continue
+			}
+
+			next, err := url.Parse(strings.Trim(target, "<>"))
+			if err != nil {
+				return nil, err
+			}
+
+			return current.ResolveReference(next), nil
+		}
+	}
+
+	return nil, nil
+}
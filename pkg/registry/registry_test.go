@@ -0,0 +1,94 @@
+package registry_test
+
+import (
+	"fmt"
+	"github.com/dawidd6/deber/pkg/registry"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "registry.test", r.URL.Query().Get("service"))
+		assert.Equal(t, "repository:debian:pull", r.URL.Query().Get("scope"))
+		fmt.Fprint(w, `{"token": "secret"}`)
+	})
+
+	mux.HandleFunc("/v2/debian/tags/list", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry.test",scope="repository:debian:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query().Get("last") == "" {
+			w.Header().Set("Link", `</v2/debian/tags/list?last=bookworm&n=2>; rel="next"`)
+			fmt.Fprint(w, `{"name": "debian", "tags": ["bullseye", "bookworm"]}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"name": "debian", "tags": ["trixie"]}`)
+	})
+
+	mux.HandleFunc("/v2/ubuntu/tags/list", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "ubuntu", "tags": ["jammy", "noble"]}`)
+	})
+
+	return server
+}
+
+func TestTags(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	client, err := registry.New(server.URL)
+	assert.NoError(t, err)
+
+	tags, err := client.Tags("debian")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bullseye", "bookworm", "trixie"}, tags)
+
+	_, err = client.Tags("nonexistent")
+	assert.Error(t, err)
+}
+
+func TestMatchRepo(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	client, err := registry.New(server.URL)
+	assert.NoError(t, err)
+
+	repo, err := client.MatchRepo([]string{"debian", "ubuntu"}, "noble")
+	assert.NoError(t, err)
+	assert.Equal(t, "ubuntu", repo)
+
+	_, err = client.MatchRepo([]string{"debian", "ubuntu"}, "nonexistent")
+	assert.Error(t, err)
+
+	// Failing repo doesn't stop the search
+	repo, err = client.MatchRepo([]string{"nonexistent", "ubuntu"}, "noble")
+	assert.NoError(t, err)
+	assert.Equal(t, "ubuntu", repo)
+
+	_, err = client.MatchRepo([]string{"nonexistent", "ubuntu"}, "trixie")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "nonexistent")
+}
+
+func TestReference(t *testing.T) {
+	hub, err := registry.New(registry.DefaultHost)
+	assert.NoError(t, err)
+	assert.Equal(t, "debian", hub.Reference("debian"))
+
+	mirror, err := registry.New("registry.corp")
+	assert.NoError(t, err)
+	assert.Equal(t, "registry.corp/debian", mirror.Reference("debian"))
+	assert.Equal(t, "registry.corp/devuan/devuan", mirror.Reference("devuan/devuan"))
+	assert.Equal(t, "localhost:5000/debian", mirror.Reference("localhost:5000/debian"))
+}
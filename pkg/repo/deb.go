@@ -0,0 +1,124 @@
+package repo
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	arMagic      = "!<arch>\n"
+	arHeaderSize = 60
+)
+
+// ReadControl function extracts control file from .deb package
+// at given path.
+//
+// Uncompressed, gzip, xz and zstd compressed control members are supported.
+func ReadControl(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	magic := make([]byte, len(arMagic))
+	_, err = io.ReadFull(reader, magic)
+	if err != nil || string(magic) != arMagic {
+		return nil, fmt.Errorf("%s: not a Debian package", path)
+	}
+
+	for {
+		header := make([]byte, arHeaderSize)
+		_, err = io.ReadFull(reader, header)
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s: control member not found", path)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: malformed member header", path)
+		}
+
+		member := io.LimitReader(reader, size)
+
+		if strings.HasPrefix(name, "control.tar") {
+			control, err := readControlMember(member, filepath.Ext(name))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", path, err)
+			}
+
+			return control, nil
+		}
+
+		// Members are aligned to even offsets
+		_, err = io.CopyN(ioutil.Discard, reader, size+size%2)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func readControlMember(member io.Reader, ext string) ([]byte, error) {
+	var reader io.Reader
+
+	switch ext {
+	case ".tar":
+		reader = member
+	case ".gz":
+		gzipReader, err := gzip.NewReader(member)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case ".xz":
+		xzReader, err := xz.NewReader(member)
+		if err != nil {
+			return nil, err
+		}
+		reader = xzReader
+	case ".zst":
+		zstdReader, err := zstd.NewReader(member)
+		if err != nil {
+			return nil, err
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	default:
+		return nil, fmt.Errorf("unsupported control compression: %s", ext)
+	}
+
+	tarReader := tar.NewReader(reader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, errors.New("control file not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if path.Clean(header.Name) == "control" {
+			return ioutil.ReadAll(tarReader)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Package repo includes local APT repository generation utilities
+package repo
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/dawidd6/deber/pkg/control"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// PackagesFile constant is the name of binary packages index
+	PackagesFile = "Packages"
+	// SourcesFile constant is the name of source packages index
+	SourcesFile = "Sources"
+	// ReleaseFile constant is the name of repository release file
+	ReleaseFile = "Release"
+	// InReleaseFile constant is the name of clearsigned release file
+	InReleaseFile = "InRelease"
+	// ReleaseSignatureFile constant is the name of detached release signature
+	ReleaseSignatureFile = "Release.gpg"
+)
+
+// checksum struct holds checksums and size of single file.
+type checksum struct {
+	Size   int64
+	MD5    string
+	SHA1   string
+	SHA256 string
+}
+
+func sum(data []byte) checksum {
+	digest := func(h hash.Hash) string {
+		h.Write(data)
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	return checksum{
+		Size:   int64(len(data)),
+		MD5:    digest(md5.New()),
+		SHA1:   digest(sha1.New()),
+		SHA256: digest(sha256.New()),
+	}
+}
+
+// Exists function checks if repository index was generated in given directory.
+func Exists(dir string) bool {
+	info, _ := os.Stat(filepath.Join(dir, ReleaseFile))
+
+	return info != nil
+}
+
+// Generate function walks given directory, indexes all found
+// .deb and .dsc files and writes Packages, Sources and Release files
+// into it, so it can be used as a flat APT repository.
+//
+// Signatures of previous Release file are removed,
+// as they don't match anymore.
+func Generate(dir string) error {
+	packages := new(strings.Builder)
+	sources := new(strings.Builder)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		switch filepath.Ext(path) {
+		case ".deb":
+			stanza, err := packageStanza(path, filepath.ToSlash(rel))
+			if err != nil {
+				return err
+			}
+			packages.WriteString(stanza + "\n")
+		case ".dsc":
+			stanza, err := sourceStanza(path, filepath.ToSlash(rel))
+			if err != nil {
+				return err
+			}
+			sources.WriteString(stanza + "\n")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	indexes := map[string][]byte{
+		PackagesFile: []byte(packages.String()),
+		SourcesFile:  []byte(sources.String()),
+	}
+
+	for name, data := range indexes {
+		err = ioutil.WriteFile(filepath.Join(dir, name), data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range []string{InReleaseFile, ReleaseSignatureFile} {
+		err = os.Remove(filepath.Join(dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	release := releaseFile(indexes)
+
+	return ioutil.WriteFile(filepath.Join(dir, ReleaseFile), []byte(release), 0644)
+}
+
+// packageStanza returns Packages entry of .deb at given path.
+func packageStanza(path, rel string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	controlData, err := ReadControl(path)
+	if err != nil {
+		return "", err
+	}
+
+	paragraphs, err := control.ParseBytes(controlData)
+	if err != nil {
+		return "", err
+	}
+	if len(paragraphs) != 1 {
+		return "", fmt.Errorf("%s: malformed control file", path)
+	}
+
+	c := sum(data)
+	paragraph := paragraphs[0]
+	paragraph.Set("Filename", rel)
+	paragraph.Set("Size", fmt.Sprint(c.Size))
+	paragraph.Set("MD5sum", c.MD5)
+	paragraph.Set("SHA1", c.SHA1)
+	paragraph.Set("SHA256", c.SHA256)
+
+	return paragraph.String(), nil
+}
+
+// sourceStanza returns Sources entry of .dsc at given path.
+func sourceStanza(path, rel string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	paragraphs, err := control.ParseBytes(data)
+	if err != nil {
+		return "", err
+	}
+	if len(paragraphs) != 1 {
+		return "", fmt.Errorf("%s: malformed source control file", path)
+	}
+
+	c := sum(data)
+	name := filepath.Base(rel)
+	paragraph := make(control.Paragraph, 0)
+
+	for _, field := range paragraphs[0] {
+		switch strings.ToLower(field.Name) {
+		case "source":
+			// Package field must come first
+			paragraph = append(control.Paragraph{{Name: "Package", Value: field.Value}}, paragraph...)
+		case "files":
+			field.Value += fmt.Sprintf("\n %s %d %s", c.MD5, c.Size, name)
+			paragraph = append(paragraph, field)
+		case "checksums-sha1":
+			field.Value += fmt.Sprintf("\n %s %d %s", c.SHA1, c.Size, name)
+			paragraph = append(paragraph, field)
+		case "checksums-sha256":
+			field.Value += fmt.Sprintf("\n %s %d %s", c.SHA256, c.Size, name)
+			paragraph = append(paragraph, field)
+		default:
+			paragraph = append(paragraph, field)
+		}
+	}
+
+	paragraph.Set("Directory", filepath.Dir(rel))
+
+	return paragraph.String(), nil
+}
+
+// releaseFile returns contents of Release file for given indexes.
+func releaseFile(indexes map[string][]byte) string {
+	names := make([]string, 0)
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	md5Sums := ""
+	sha1Sums := ""
+	sha256Sums := ""
+
+	for _, name := range names {
+		c := sum(indexes[name])
+		md5Sums += fmt.Sprintf("\n %s %d %s", c.MD5, c.Size, name)
+		sha1Sums += fmt.Sprintf("\n %s %d %s", c.SHA1, c.Size, name)
+		sha256Sums += fmt.Sprintf("\n %s %d %s", c.SHA256, c.Size, name)
+	}
+
+	release := control.Paragraph{
+		{Name: "Origin", Value: "deber"},
+		{Name: "Label", Value: "deber"},
+		{Name: "Date", Value: time.Now().UTC().Format(time.RFC1123)},
+		{Name: "MD5Sum", Value: md5Sums},
+		{Name: "SHA1", Value: sha1Sums},
+		{Name: "SHA256", Value: sha256Sums},
+	}
+
+	return release.String()
+}
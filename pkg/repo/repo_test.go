@@ -0,0 +1,113 @@
+package repo_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/dawidd6/deber/pkg/control"
+	"github.com/dawidd6/deber/pkg/repo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const controlFile = `Package: pkg
+Version: 1.0-1
+Architecture: amd64
+Description: test package
+ Long description.
+`
+
+func tarGz(t *testing.T, name string, data []byte) []byte {
+	buffer := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))})
+	assert.NoError(t, err)
+	_, err = tarWriter.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, tarWriter.Close())
+	assert.NoError(t, gzipWriter.Close())
+
+	return buffer.Bytes()
+}
+
+func writeDeb(t *testing.T, path string) {
+	members := []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", tarGz(t, "./control", []byte(controlFile))},
+		{"data.tar.gz", tarGz(t, "./usr/share/doc/pkg/README", []byte("readme"))},
+	}
+
+	buffer := bytes.NewBufferString("!<arch>\n")
+	for _, member := range members {
+		fmt.Fprintf(buffer, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, 0, 0, 0, "100644", len(member.data))
+		buffer.Write(member.data)
+		if len(member.data)%2 == 1 {
+			buffer.WriteByte('\n')
+		}
+	}
+
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(path, buffer.Bytes(), 0644))
+}
+
+func TestReadControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deber-repo")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pkg_1.0-1_amd64.deb")
+	writeDeb(t, path)
+
+	data, err := repo.ReadControl(path)
+	assert.NoError(t, err)
+	assert.Equal(t, controlFile, string(data))
+}
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deber-repo")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.False(t, repo.Exists(dir))
+
+	writeDeb(t, filepath.Join(dir, "pkg", "1.0-1", "pkg_1.0-1_amd64.deb"))
+	err = ioutil.WriteFile(filepath.Join(dir, "pkg", "1.0-1", "pkg_1.0-1.dsc"), []byte(`Format: 3.0 (native)
+Source: pkg
+Version: 1.0-1
+Files:
+ 0123 100 pkg_1.0-1.tar.xz
+`), 0644)
+	assert.NoError(t, err)
+
+	err = repo.Generate(dir)
+	assert.NoError(t, err)
+	assert.True(t, repo.Exists(dir))
+
+	packages, err := control.ParseFile(filepath.Join(dir, repo.PackagesFile))
+	assert.NoError(t, err)
+	assert.Len(t, packages, 1)
+	assert.Equal(t, "pkg", packages[0].Get("Package"))
+	assert.Equal(t, "pkg/1.0-1/pkg_1.0-1_amd64.deb", packages[0].Get("Filename"))
+	assert.Len(t, packages[0].Get("SHA256"), 64)
+
+	sources, err := control.ParseFile(filepath.Join(dir, repo.SourcesFile))
+	assert.NoError(t, err)
+	assert.Len(t, sources, 1)
+	assert.Equal(t, "Package", sources[0][0].Name)
+	assert.Equal(t, "pkg/1.0-1", sources[0].Get("Directory"))
+	assert.Len(t, sources[0].Lines("Files"), 2)
+
+	release, err := control.ParseFile(filepath.Join(dir, repo.ReleaseFile))
+	assert.NoError(t, err)
+	assert.Len(t, release, 1)
+	assert.Len(t, release[0].Lines("SHA256"), 2)
+}
@@ -0,0 +1,253 @@
+// Package report includes machine-readable build report
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/dawidd6/deber/pkg/lintian"
+	"github.com/dawidd6/deber/pkg/log"
+	"github.com/dawidd6/deber/pkg/naming"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// StatusSuccess constant represents successful build
+	StatusSuccess = "success"
+	// StatusFailure constant represents failed build
+	StatusFailure = "failure"
+)
+
+// Report struct represents summary of single build.
+type Report struct {
+	Source    string        `json:"source"`
+	Version   string        `json:"version"`
+	Target    string        `json:"target"`
+	Arch      string        `json:"arch,omitempty"`
+	HostArch  string        `json:"host_arch,omitempty"`
+	Image     string        `json:"image"`
+	Container string        `json:"container"`
+	Parent    Parent        `json:"parent"`
+	Status    string        `json:"status"`
+	Steps     []Step        `json:"steps"`
+	Files     []File        `json:"files"`
+	Lintian   []lintian.Tag `json:"lintian"`
+}
+
+// Batch struct represents summary of builds of multiple packages.
+type Batch struct {
+	Status  string    `json:"status"`
+	Reports []*Report `json:"reports"`
+}
+
+// Parent struct represents parent image the build image was made from.
+type Parent struct {
+	Image  string `json:"image,omitempty"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// Step struct represents result of single step.
+type Step struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// File struct represents single archived file.
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// New function creates report for build with given naming.
+func New(n *naming.Naming) *Report {
+	return &Report{
+		Source:    n.Source,
+		Version:   n.Version,
+		Target:    n.Target,
+		Arch:      n.Arch,
+		HostArch:  n.HostArch,
+		Image:     n.Image,
+		Container: n.Container,
+		Status:    StatusSuccess,
+		Steps:     make([]Step, 0),
+		Files:     make([]File, 0),
+		Lintian:   make([]lintian.Tag, 0),
+	}
+}
+
+// NewFailed function creates report of build of source
+// that failed in given step, before its naming was known.
+func NewFailed(source, step string, duration time.Duration, err error) *Report {
+	report := &Report{
+		Source:  source,
+		Status:  StatusSuccess,
+		Steps:   make([]Step, 0),
+		Files:   make([]File, 0),
+		Lintian: make([]lintian.Tag, 0),
+	}
+	report.AddStep(step, log.StatusFailed, duration, err)
+
+	return report
+}
+
+// NewBatch function creates empty report of multiple builds.
+func NewBatch() *Batch {
+	return &Batch{
+		Status:  StatusSuccess,
+		Reports: make([]*Report, 0),
+	}
+}
+
+// ReadFile function decodes report from JSON file.
+func ReadFile(path string) (*Report, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	report := new(Report)
+
+	err = json.Unmarshal(data, report)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return report, nil
+}
+
+// AddStep function records result of step.
+//
+// Any error marks the whole build as failed.
+func (report *Report) AddStep(name, status string, duration time.Duration, err error) {
+	step := Step{
+		Name:     name,
+		Status:   status,
+		Duration: duration.Seconds(),
+	}
+
+	if err != nil {
+		step.Error = err.Error()
+		report.Status = StatusFailure
+	}
+
+	report.Steps = append(report.Steps, step)
+}
+
+// SetParent function records parent image
+// from labels of build image.
+func (report *Report) SetParent(labels map[string]string) {
+	report.Parent = Parent{
+		Image:  labels[naming.LabelParentImage],
+		Digest: labels[naming.LabelParent],
+	}
+}
+
+// AddFiles function records all files in given directory
+// along with their checksums.
+//
+// Non existent directory is not an error, as nothing was archived yet.
+func (report *Report) AddFiles(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return err
+		}
+
+		checksum := sha256.Sum256(data)
+
+		report.Files = append(report.Files, File{
+			Name:   f.Name(),
+			Size:   f.Size(),
+			SHA256: hex.EncodeToString(checksum[:]),
+		})
+	}
+
+	return nil
+}
+
+// AddLintian function records tags from lintian output file at given path.
+func (report *Report) AddLintian(path string) error {
+	tags, err := lintian.ParseFile(path)
+	if err != nil {
+		return err
+	}
+
+	report.Lintian = append(report.Lintian, tags...)
+
+	return nil
+}
+
+// Write function encodes report as indented JSON into writer.
+func (report *Report) Write(writer io.Writer) error {
+	return write(writer, report)
+}
+
+// WriteFile function encodes report as indented JSON into file.
+func (report *Report) WriteFile(path string) error {
+	return writeFile(path, report)
+}
+
+// Add function records report of single build.
+//
+// Any failed build marks the whole batch as failed.
+func (batch *Batch) Add(report *Report) {
+	if report.Status != StatusSuccess {
+		batch.Status = StatusFailure
+	}
+
+	batch.Reports = append(batch.Reports, report)
+}
+
+// Write function encodes batch report as indented JSON into writer.
+func (batch *Batch) Write(writer io.Writer) error {
+	return write(writer, batch)
+}
+
+// WriteFile function encodes batch report as indented JSON into file.
+func (batch *Batch) WriteFile(path string) error {
+	return writeFile(path, batch)
+}
+
+// write encodes value as indented JSON into writer.
+func write(writer io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}
+
+// writeFile encodes value as indented JSON into file.
+func writeFile(path string, value interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = write(file, value)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
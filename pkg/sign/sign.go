@@ -0,0 +1,274 @@
+// Package sign includes OpenPGP signing utilities
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dawidd6/deber/pkg/control"
+	"github.com/dawidd6/deber/pkg/repo"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var config = &packet.Config{
+	DefaultHash: crypto.SHA256,
+}
+
+// Signer struct represents OpenPGP key used for signing.
+type Signer struct {
+	entity *openpgp.Entity
+}
+
+// Load function reads armored secret key from given path
+// and decrypts it with passphrase if needed.
+func Load(path, passphrase string) (*Signer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entities, err := openpgp.ReadArmoredKeyRing(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	if len(entities) != 1 {
+		return nil, fmt.Errorf("%s: expected exactly one key", path)
+	}
+
+	entity := entities[0]
+	if entity.PrivateKey == nil {
+		return nil, fmt.Errorf("%s: no secret key found", path)
+	}
+
+	if entity.PrivateKey.Encrypted {
+		if passphrase == "" {
+			return nil, fmt.Errorf("%s: key is encrypted, passphrase needed", path)
+		}
+
+		err = entity.PrivateKey.Decrypt([]byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	return &Signer{entity: entity}, nil
+}
+
+// ClearSign function returns given data wrapped in cleartext signature.
+func (signer *Signer) ClearSign(data []byte) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+
+	writer, err := clearsign.Encode(buffer, signer.entity.PrivateKey, config)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = writer.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Signature armor lacks trailing newline
+	buffer.WriteString("\n")
+
+	return buffer.Bytes(), nil
+}
+
+// DetachSign function returns armored detached signature of given data.
+func (signer *Signer) DetachSign(data []byte) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+
+	err := openpgp.ArmoredDetachSign(buffer, signer.entity, bytes.NewReader(data), config)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer.WriteString("\n")
+
+	return buffer.Bytes(), nil
+}
+
+// SignRepo function signs Release file of repository in given directory,
+// writing InRelease and Release.gpg files.
+func (signer *Signer) SignRepo(dir string) error {
+	release, err := ioutil.ReadFile(filepath.Join(dir, repo.ReleaseFile))
+	if err != nil {
+		return err
+	}
+
+	inRelease, err := signer.ClearSign(release)
+	if err != nil {
+		return err
+	}
+
+	signature, err := signer.DetachSign(release)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, repo.InReleaseFile), inRelease, 0644)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, repo.ReleaseSignatureFile), signature, 0644)
+}
+
+// SignChanges function signs .changes files at given paths
+// like debsign does.
+//
+// .dsc and .buildinfo files listed in them are signed first (only once,
+// even if listed in multiple .changes files) and their checksums
+// in .changes are updated accordingly.
+func (signer *Signer) SignChanges(paths ...string) error {
+	signedFiles := make(map[string][]byte)
+
+	for _, path := range paths {
+		data, err := ReadUnsigned(path)
+		if err != nil {
+			return err
+		}
+
+		paragraphs, err := control.ParseBytes(data)
+		if err != nil {
+			return err
+		}
+		if len(paragraphs) != 1 {
+			return fmt.Errorf("%s: malformed changes file", path)
+		}
+
+		changes := paragraphs[0]
+
+		for _, line := range changes.Lines("Files") {
+			fields := strings.Fields(line)
+			name := filepath.Join(filepath.Dir(path), fields[len(fields)-1])
+
+			if !strings.HasSuffix(name, ".dsc") && !strings.HasSuffix(name, ".buildinfo") {
+				continue
+			}
+
+			if _, ok := signedFiles[name]; !ok {
+				signedFiles[name], err = signer.signFile(name)
+				if err != nil {
+					return err
+				}
+			}
+
+			updateChecksums(changes, filepath.Base(name), signedFiles[name])
+		}
+
+		signed, err := signer.ClearSign([]byte(changes.String()))
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(path, signed, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// signFile clearsigns file at given path in place
+// and returns its new contents.
+func (signer *Signer) signFile(path string) ([]byte, error) {
+	data, err := ReadUnsigned(path)
+	if err != nil {
+		return nil, err
+	}
+
+	signed, err := signer.ClearSign(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ioutil.WriteFile(path, signed, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return signed, nil
+}
+
+// ReadUnsigned function returns contents of file at given path,
+// stripping existing cleartext signature if any.
+func ReadUnsigned(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte("-----BEGIN PGP SIGNED MESSAGE-----")) {
+		return data, nil
+	}
+
+	block, _ := clearsign.Decode(data)
+	if block == nil {
+		return nil, errors.New(path + ": malformed signature")
+	}
+
+	plaintext := block.Plaintext
+	if !bytes.HasSuffix(plaintext, []byte("\n")) {
+		plaintext = append(plaintext, '\n')
+	}
+
+	return plaintext, nil
+}
+
+// updateChecksums replaces size and checksums of file with given name
+// in all checksum fields of .changes paragraph.
+func updateChecksums(changes control.Paragraph, name string, data []byte) {
+	digest := func(h hash.Hash) string {
+		h.Write(data)
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	fields := map[string]string{
+		"Files":            digest(md5.New()),
+		"Checksums-Sha1":   digest(sha1.New()),
+		"Checksums-Sha256": digest(sha256.New()),
+	}
+
+	for field, checksum := range fields {
+		value := changes.Get(field)
+		if value == "" {
+			continue
+		}
+
+		lines := strings.Split(value, "\n")
+		for i, line := range lines {
+			parts := strings.Fields(line)
+			if len(parts) < 3 || parts[len(parts)-1] != name {
+				continue
+			}
+
+			// Files field has section and priority in between
+			parts[0] = checksum
+			parts[1] = fmt.Sprint(len(data))
+			lines[i] = " " + strings.Join(parts, " ")
+		}
+
+		changes.Set(field, strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,135 @@
+package sign_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/dawidd6/deber/pkg/control"
+	"github.com/dawidd6/deber/pkg/repo"
+	"github.com/dawidd6/deber/pkg/sign"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setup generates throwaway key, writes it into temporary directory
+// and returns keyring for verification.
+//
+// Directory is removed when test finishes, even if setup fails halfway.
+func setup(t *testing.T) (string, openpgp.EntityList) {
+	dir, err := ioutil.TempDir("", "deber-sign")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	entity, err := openpgp.NewEntity("deber", "test", "deber@example.com", nil)
+	assert.NoError(t, err)
+
+	buffer := new(bytes.Buffer)
+	writer, err := armor.Encode(buffer, openpgp.PrivateKeyType, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, entity.SerializePrivate(writer, nil))
+	assert.NoError(t, writer.Close())
+
+	err = ioutil.WriteFile(filepath.Join(dir, "key.asc"), buffer.Bytes(), 0600)
+	assert.NoError(t, err)
+
+	return dir, openpgp.EntityList{entity}
+}
+
+func verifyClearSigned(t *testing.T, path string, keyring openpgp.EntityList) []byte {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+
+	block, _ := clearsign.Decode(data)
+	assert.NotNil(t, block)
+
+	_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body)
+	assert.NoError(t, err)
+
+	return block.Plaintext
+}
+
+func TestLoadMissing(t *testing.T) {
+	_, err := sign.Load("/nonexistent/key.asc", "")
+	assert.Error(t, err)
+}
+
+func TestSignRepo(t *testing.T) {
+	dir, keyring := setup(t)
+
+	signer, err := sign.Load(filepath.Join(dir, "key.asc"), "")
+	assert.NoError(t, err)
+
+	err = repo.Generate(dir)
+	assert.NoError(t, err)
+
+	err = signer.SignRepo(dir)
+	assert.NoError(t, err)
+
+	release, err := ioutil.ReadFile(filepath.Join(dir, repo.ReleaseFile))
+	assert.NoError(t, err)
+
+	signature, err := os.Open(filepath.Join(dir, repo.ReleaseSignatureFile))
+	assert.NoError(t, err)
+	defer signature.Close()
+
+	_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(release), signature)
+	assert.NoError(t, err)
+
+	plaintext := verifyClearSigned(t, filepath.Join(dir, repo.InReleaseFile), keyring)
+	assert.Equal(t, string(bytes.TrimSpace(release)), string(bytes.TrimSpace(plaintext)))
+
+	// Regenerating index drops stale signatures
+	err = repo.Generate(dir)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, repo.InReleaseFile))
+}
+
+func TestSignChanges(t *testing.T) {
+	dir, keyring := setup(t)
+
+	signer, err := sign.Load(filepath.Join(dir, "key.asc"), "")
+	assert.NoError(t, err)
+
+	dsc := []byte("Format: 3.0 (native)\nSource: pkg\nVersion: 1.0\n")
+	err = ioutil.WriteFile(filepath.Join(dir, "pkg_1.0.dsc"), dsc, 0644)
+	assert.NoError(t, err)
+
+	checksum := md5.Sum(dsc)
+	changes := fmt.Sprintf("Source: pkg\nVersion: 1.0\nFiles:\n %s %d utils optional pkg_1.0.dsc\n 0123 10 utils optional pkg_1.0.tar.xz\n",
+		hex.EncodeToString(checksum[:]), len(dsc))
+	for _, name := range []string{"pkg_1.0_source.changes", "pkg_1.0_amd64.changes"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(changes), 0644)
+		assert.NoError(t, err)
+	}
+
+	paths := []string{
+		filepath.Join(dir, "pkg_1.0_source.changes"),
+		filepath.Join(dir, "pkg_1.0_amd64.changes"),
+	}
+	err = signer.SignChanges(paths...)
+	assert.NoError(t, err)
+
+	verifyClearSigned(t, filepath.Join(dir, "pkg_1.0.dsc"), keyring)
+
+	signedDsc, err := ioutil.ReadFile(filepath.Join(dir, "pkg_1.0.dsc"))
+	assert.NoError(t, err)
+	signedChecksum := md5.Sum(signedDsc)
+
+	for _, path := range paths {
+		plaintext := verifyClearSigned(t, path, keyring)
+
+		paragraphs, err := control.ParseBytes(plaintext)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			fmt.Sprintf("%s %d utils optional pkg_1.0.dsc", hex.EncodeToString(signedChecksum[:]), len(signedDsc)),
+			"0123 10 utils optional pkg_1.0.tar.xz",
+		}, paragraphs[0].Lines("Files"))
+	}
+}
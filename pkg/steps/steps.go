@@ -4,66 +4,198 @@ package steps
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/dawidd6/deber/pkg/arch"
+	"github.com/dawidd6/deber/pkg/control"
+	"github.com/dawidd6/deber/pkg/distro"
 	"github.com/dawidd6/deber/pkg/docker"
 	"github.com/dawidd6/deber/pkg/dockerfile"
-	"github.com/dawidd6/deber/pkg/dockerhub"
+	"github.com/dawidd6/deber/pkg/lintian"
+	"github.com/dawidd6/deber/pkg/lock"
 	"github.com/dawidd6/deber/pkg/log"
 	"github.com/dawidd6/deber/pkg/naming"
+	"github.com/dawidd6/deber/pkg/repo"
+	"github.com/dawidd6/deber/pkg/sign"
 	"github.com/dawidd6/deber/pkg/util"
 	"github.com/docker/docker/api/types/mount"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"pault.ag/go/debian/version"
 	"strings"
 	"time"
 )
 
-// Build function determines parent image name by querying DockerHub API
-// for available "debian" and "ubuntu" tags and confronting them with
-// debian/changelog's target distribution.
+// BuildArgs struct represents arguments
+// passed to Build().
+type BuildArgs struct {
+	// Resolver determines parent image of target distribution
+	Resolver *distro.Resolver
+	// Customization is applied to Dockerfile
+	Customization dockerfile.Customization
+	// MaxAge is the time after which image is rebuilt
+	MaxAge time.Duration
+	// Rebuild forces rebuilding of existing image
+	Rebuild bool
+	// NoRebuild prevents rebuilding of existing image
+	NoRebuild bool
+	// AptProxy is used by apt during build, but not stored in image
+	AptProxy string
+}
+
+// Build function determines parent image name of debian/changelog's
+// target distribution with given resolver.
+//
+// Dockerfile is rendered with user customization, if any.
+//
+// If image exists, it will be rebuilt if it's old enough, was built
+// from different Dockerfile or parent image got updated in registry,
+// unless rebuild is forced or prevented.
 //
-// If image exists and is old enough, it will be rebuilt.
+// If foreign architecture is requested, it checks if host can emulate it
+// and builds image from parent of matching platform.
 //
-// At last it commands Docker Engine to build image.
-func Build(dock *docker.Docker, n *naming.Naming, maxAge time.Duration) error {
+// At last it commands Docker Engine to build image,
+// labeling it with Dockerfile hash and parent image reference and digest.
+//
+// Parent image is pulled only if it's missing or registry has newer one.
+// Digest of local parent is used if registry can't be reached,
+// so parent pinned by digest and pulled before needs no registry at all.
+func Build(dock *docker.Docker, n *naming.Naming, args BuildArgs) error {
 	log.Info("Building image")
 
 	isImageBuilt, err := dock.IsImageBuilt(n.Image)
 	if err != nil {
 		return log.Failed(err)
 	}
-	if isImageBuilt {
-		age, err := dock.ImageAge(n.Image)
+	if isImageBuilt && args.NoRebuild {
+		return log.Skipped()
+	}
+
+	from, err := args.Resolver.Resolve(n.Target)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	dockerFile, err := dockerfile.Parse(from, n.HostArch, args.Customization)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	checksum := sha256.Sum256(dockerFile)
+	labels := map[string]string{
+		naming.LabelDockerfile:  hex.EncodeToString(checksum[:]),
+		naming.LabelParentImage: from,
+	}
+
+	platform := ""
+	if n.Arch != "" {
+		platform, err = arch.Platform(n.Arch)
+		if err != nil {
+			return log.Failed(err)
+		}
+	}
+
+	// Parent pinned by digest doesn't need to be looked up nor pulled again
+	pinned := strings.Contains(from, "@")
+	pull := false
+	if pinned {
+		labels[naming.LabelParent] = from[strings.Index(from, "@")+1:]
+	} else {
+		local, err := dock.ImageRepoDigest(from, platform)
+		if err != nil {
+			return log.Failed(err)
+		}
+
+		// Registry may be unreachable, local parent is used then
+		digest, err := dock.ImageDigest(from)
+		if err != nil {
+			log.Debug("couldn't get digest of parent image: " + err.Error())
+			digest = local
+		}
+
+		if digest != "" {
+			labels[naming.LabelParent] = digest
+		}
+
+		pull = digest != local
+	}
+
+	if isImageBuilt && !args.Rebuild {
+		stale, err := isImageStale(dock, n, labels, args.MaxAge)
 		if err != nil {
 			return log.Failed(err)
 		}
 
-		if age < maxAge {
+		if !stale {
 			return log.Skipped()
 		}
 	}
 
-	repos := []string{"debian", "ubuntu"}
-	repo, err := dockerhub.MatchRepo(repos, n.Target)
+	if n.Arch != "" {
+		err = arch.CheckEmulation(n.Arch)
+		if err != nil {
+			return log.Failed(err)
+		}
+	}
+
+	log.Drop()
+
+	log.Debug("parent image: " + from + " " + labels[naming.LabelParent])
+
+	imageArgs := docker.ImageBuildArgs{
+		Name:       n.Image,
+		Dockerfile: dockerFile,
+		Platform:   platform,
+		Labels:     labels,
+		PullParent: pull,
+		HTTPProxy:  args.AptProxy,
+		Output:     log.Writer(),
+	}
+	err = dock.ImageBuild(imageArgs)
 	if err != nil {
 		return log.Failed(err)
 	}
 
-	dockerFile, err := dockerfile.Parse(repo, n.Target)
+	return log.Done()
+}
+
+// isImageStale function checks if existing image is older than maxAge
+// or its labels differ from given ones.
+//
+// Missing parent digest in given labels means it's unknown and it's not compared.
+func isImageStale(dock *docker.Docker, n *naming.Naming, labels map[string]string, maxAge time.Duration) (bool, error) {
+	age, err := dock.ImageAge(n.Image)
 	if err != nil {
-		return log.Failed(err)
+		return false, err
 	}
 
-	log.Drop()
+	if age >= maxAge {
+		log.Debug("image is too old")
+		return true, nil
+	}
 
-	err = dock.ImageBuild(n.Image, dockerFile)
+	oldLabels, err := dock.ImageLabels(n.Image)
 	if err != nil {
-		return log.Failed(err)
+		return false, err
 	}
 
-	return log.Done()
+	if oldLabels[naming.LabelDockerfile] != labels[naming.LabelDockerfile] {
+		log.Debug("image was built from different Dockerfile")
+		return true, nil
+	}
+
+	parent, ok := labels[naming.LabelParent]
+	if ok && oldLabels[naming.LabelParent] != parent {
+		log.Debug("parent image was updated")
+		return true, nil
+	}
+
+	return false, nil
 }
 
 // Create function commands Docker Engine to create container.
@@ -74,8 +206,11 @@ func Build(dock *docker.Docker, n *naming.Naming, maxAge time.Duration) error {
 // If container already exists and mounts are different, then it
 // removes the old one and creates new with proper mounts.
 //
+// Apt cache directory is not mounted if apt proxy is used,
+// as sharing it between concurrent builds is racy.
+//
 // Also makes directories on host and moves tarball if needed.
-func Create(dock *docker.Docker, n *naming.Naming, extraPackages []string) error {
+func Create(dock *docker.Docker, n *naming.Naming, extraPackages []string, aptProxy string) error {
 	log.Info("Creating container")
 
 	mounts := []mount.Mount{
@@ -88,10 +223,19 @@ func Create(dock *docker.Docker, n *naming.Naming, extraPackages []string) error
 			Source: n.BuildDir,
 			Target: naming.ContainerBuildDir,
 		}, {
+			Type:     mount.TypeBind,
+			Source:   n.ArchiveTargetDir,
+			Target:   naming.ContainerRepoDir,
+			ReadOnly: true,
+		},
+	}
+
+	if aptProxy == "" {
+		mounts = append(mounts, mount.Mount{
 			Type:   mount.TypeBind,
 			Source: n.CacheDir,
 			Target: naming.ContainerCacheDir,
-		},
+		})
 	}
 
 	// Handle extra packages mounting
@@ -129,6 +273,10 @@ func Create(dock *docker.Docker, n *naming.Naming, extraPackages []string) error
 		}
 	}
 
+	for _, mnt := range mounts {
+		log.Debug("mount: " + mnt.Source + " -> " + mnt.Target)
+	}
+
 	isContainerCreated, err := dock.IsContainerCreated(n.Container)
 	if err != nil {
 		return log.Failed(err)
@@ -269,7 +417,8 @@ func Tarball(n *naming.Naming) error {
 			return log.Failed(err)
 		}
 
-		err = os.Rename(src, dst)
+		// Tarball stays in place for other builds of the same source
+		err = util.LinkOrCopy(src, dst)
 		if err != nil {
 			return log.Failed(err)
 		}
@@ -282,16 +431,67 @@ func Tarball(n *naming.Naming) error {
 
 // Depends function installs build dependencies of package
 // in container.
-func Depends(dock *docker.Docker, n *naming.Naming, extraPackages []string) error {
+//
+// Packages from archive of the same target are available too,
+// via local repository.
+//
+// When cross-building, dependencies for host architecture are installed.
+//
+// Apt in container is configured to use given proxy, if any.
+func Depends(dock *docker.Docker, n *naming.Naming, extraPackages []string, aptProxy string) error {
 	log.Info("Installing dependencies")
+
+	// apt fails on repository without index
+	if !repo.Exists(n.ArchiveTargetDir) {
+		archiveLock, err := lock.Acquire(n.ArchiveLock)
+		if err != nil {
+			return log.Failed(err)
+		}
+
+		err = repo.Generate(n.ArchiveTargetDir)
+		archiveLock.Release()
+		if err != nil {
+			return log.Failed(err)
+		}
+	}
+
 	log.Drop()
 
+	if aptProxy == "" {
+		cacheLock, err := lock.Acquire(n.CacheLock)
+		if err != nil {
+			return log.Failed(err)
+		}
+		defer cacheLock.Release()
+	}
+
+	buildDep := "apt-get build-dep ./ -t " + n.Target
+	if n.HostArch != "" {
+		buildDep += " -a" + n.HostArch
+	}
+
 	args := []docker.ContainerExecArgs{
 		{
+			Name:    n.Container,
+			Cmd:     "rm -f 00proxy",
+			AsRoot:  true,
+			WorkDir: "/etc/apt/apt.conf.d",
+		}, {
+			Name:    n.Container,
+			Cmd:     "echo 'Acquire::http::Proxy \"" + aptProxy + "\";' > 00proxy",
+			AsRoot:  true,
+			WorkDir: "/etc/apt/apt.conf.d",
+			Skip:    aptProxy == "",
+		}, {
 			Name:    n.Container,
 			Cmd:     "rm -f a.list",
 			AsRoot:  true,
 			WorkDir: "/etc/apt/sources.list.d",
+		}, {
+			Name:    n.Container,
+			Cmd:     "echo deb [trusted=yes] file://" + naming.ContainerRepoDir + " ./ > r.list",
+			AsRoot:  true,
+			WorkDir: "/etc/apt/sources.list.d",
 		}, {
 			Name:    n.Container,
 			Cmd:     "echo deb [trusted=yes] file://" + naming.ContainerArchiveDir + " ./ > a.list",
@@ -304,6 +504,12 @@ func Depends(dock *docker.Docker, n *naming.Naming, extraPackages []string) erro
 			AsRoot:  true,
 			WorkDir: naming.ContainerArchiveDir,
 			Skip:    extraPackages == nil,
+		}, {
+			// Images built before may lack sources of host architecture
+			Name:   n.Container,
+			Cmd:    dockerfile.CrossSources(n.HostArch),
+			AsRoot: true,
+			Skip:   n.HostArch == "",
 		}, {
 			Name:    n.Container,
 			Cmd:     "apt-get update",
@@ -311,34 +517,93 @@ func Depends(dock *docker.Docker, n *naming.Naming, extraPackages []string) erro
 			Network: true,
 		}, {
 			Name:    n.Container,
-			Cmd:     "apt-get build-dep ./ -t " + n.Target,
+			Cmd:     buildDep,
 			Network: true,
 			AsRoot:  true,
 		},
 	}
 
-	for _, arg := range args {
-		err := dock.ContainerExec(arg)
-		if err != nil {
-			return log.Failed(err)
-		}
+	buildLog, err := openBuildLog(n)
+	if err != nil {
+		return log.Failed(err)
+	}
+	defer buildLog.Close()
+
+	err = execute(dock, buildLog, args...)
+	if err != nil {
+		return log.Failed(err)
 	}
 
 	return log.Done()
 }
 
+const (
+	// ModeDefault constant leaves choice of what to build to dpkg flags
+	ModeDefault = ""
+	// ModeFull constant represents build of source and all binary packages
+	ModeFull = "full"
+	// ModeSource constant represents source-only build
+	ModeSource = "source"
+	// ModeBinaryArch constant represents build of architecture dependent binary packages only
+	ModeBinaryArch = "binary-arch"
+	// ModeBinaryIndep constant represents build of architecture independent binary packages only
+	ModeBinaryIndep = "binary-indep"
+)
+
+// modeFlags maps build modes to dpkg-buildpackage flags
+var modeFlags = map[string]string{
+	ModeFull:        "--build=full",
+	ModeSource:      "--build=source",
+	ModeBinaryArch:  "--build=any",
+	ModeBinaryIndep: "--build=all",
+}
+
+// modeOutputs maps build modes to extensions of files
+// that have to be listed in .changes produced by build
+var modeOutputs = map[string][]string{
+	ModeDefault:     {},
+	ModeFull:        {".dsc", ".buildinfo", ".deb"},
+	ModeSource:      {".dsc", ".buildinfo"},
+	ModeBinaryArch:  {".buildinfo", ".deb"},
+	ModeBinaryIndep: {".buildinfo", ".deb"},
+}
+
 // Package function executes "dpkg-buildpackage" in container.
 // enables network back.
-func Package(dock *docker.Docker, n *naming.Naming, dpkgFlags string, withNetwork bool) error {
+//
+// Build mode, if any, is passed to it before dpkg flags.
+//
+// When cross-building, host architecture is passed to it.
+func Package(dock *docker.Docker, n *naming.Naming, mode, dpkgFlags string, withNetwork bool) error {
 	log.Info("Packaging software")
 	log.Drop()
 
+	if mode != ModeDefault {
+		dpkgFlags = modeFlags[mode] + " " + dpkgFlags
+
+		// Leftover of previous run must not pass for output of this one
+		err := os.Remove(changesFile(n, mode))
+		if err != nil && !os.IsNotExist(err) {
+			return log.Failed(err)
+		}
+	}
+
+	if n.HostArch != "" {
+		dpkgFlags += " --host-arch " + n.HostArch
+	}
+
 	args := docker.ContainerExecArgs{
 		Name:    n.Container,
 		Cmd:     "dpkg-buildpackage" + " " + dpkgFlags,
 		Network: withNetwork,
 	}
-	err := dock.ContainerExec(args)
+	buildLog, err := openBuildLog(n)
+	if err != nil {
+		return log.Failed(err)
+	}
+	defer buildLog.Close()
+
+	err = execute(dock, buildLog, args)
 	if err != nil {
 		return log.Failed(err)
 	}
@@ -346,155 +611,609 @@ func Package(dock *docker.Docker, n *naming.Naming, dpkgFlags string, withNetwor
 	return log.Done()
 }
 
-// Test function executes "debi", "debc" and "lintian" in container.
-func Test(dock *docker.Docker, n *naming.Naming, lintianFlags string, noLintian bool) error {
+// TestArgs struct represents arguments
+// passed to Test().
+type TestArgs struct {
+	// LintianFlags are passed to lintian
+	LintianFlags string
+	// NoLintian disables lintian
+	NoLintian bool
+	// NoAutopkgtest disables autopkgtest
+	NoAutopkgtest bool
+	// FailOn is the lowest lintian tag severity failing the step
+	FailOn string
+	// AptProxy is used instead of apt cache directory, if set
+	AptProxy string
+	// Mode is the build mode packages were built in
+	Mode string
+}
+
+// Test function executes "debi", "debc", "autopkgtest" and "lintian" in container.
+//
+// Autopkgtest is executed with null virtualization backend against
+// freshly built packages, but only if package has any tests.
+// It must be installed in image, which custom Dockerfile template may not do.
+// Its results are stored in build directory, to be archived.
+//
+// Lintian output is stored in build directory too and its tags are summarized.
+// Warnings are compared with ones of previously archived version,
+// so only new ones can fail the step.
+//
+// Cross-built packages can't be installed, so only lintian is executed
+// on them. The same goes for source-only builds, as there are no packages at all.
+func Test(dock *docker.Docker, n *naming.Naming, testArgs TestArgs) error {
 	log.Info("Testing package")
 	log.Drop()
 
+	if testArgs.AptProxy == "" {
+		cacheLock, err := lock.Acquire(n.CacheLock)
+		if err != nil {
+			return log.Failed(err)
+		}
+		defer cacheLock.Release()
+	}
+
+	cross := n.HostArch != ""
+	source := testArgs.Mode == ModeSource
+	lintianFlags := testArgs.LintianFlags
+	changes := ""
+
+	// Tools look only for .changes of native architecture by default,
+	// which build in explicit mode may not produce
+	if testArgs.Mode != ModeDefault {
+		changes = " ../" + filepath.Base(changesFile(n, testArgs.Mode))
+		lintianFlags += changes
+	} else if cross {
+		lintianFlags += " ../*_" + n.HostArch + ".changes"
+	}
+
+	hasTests, err := hasAutopkgtests(n.SourceDir)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	runTests := hasTests && !cross && !source && !testArgs.NoAutopkgtest
+
+	// Only built-in Dockerfile template is known to install it
+	if runTests {
+		err = dock.ContainerExec(docker.ContainerExecArgs{
+			Name:   n.Container,
+			Cmd:    "command -v autopkgtest",
+			Output: ioutil.Discard,
+		})
+		if err != nil {
+			return log.Failed(errors.New("autopkgtest is not installed in image, " +
+				"install it in custom Dockerfile template or use --no-autopkgtest"))
+		}
+	}
+
+	// Results are given back to owner of build directory.
+	// Exit status 2 means some tests were skipped, 8 means there were no tests at all
+	autopkgtest := fmt.Sprintf("autopkgtest --output-dir %[1]s ../*.deb ./ -- null; status=$?; "+
+		"chown -R $(stat -c %%u:%%g %[2]s) %[1]s; "+
+		"[ $status -eq 0 ] || [ $status -eq 2 ] || [ $status -eq 8 ]",
+		naming.ContainerAutopkgtestDir, naming.ContainerBuildDir)
+
+	// Tags are judged later, exit status 1 just means some were emitted
+	lintianFile := filepath.Join(naming.ContainerBuildDir, filepath.Base(n.LintianFile))
+	lintianCmd := fmt.Sprintf("lintian %[1]s > %[2]s 2>&1; status=$?; cat %[2]s; [ $status -le 1 ]",
+		lintianFlags, lintianFile)
+
 	args := []docker.ContainerExecArgs{
 		{
 			Name:    n.Container,
-			Cmd:     "debi --with-depends",
+			Cmd:     "debi --with-depends" + changes,
 			Network: true,
 			AsRoot:  true,
+			Skip:    cross || source,
 		}, {
 			Name: n.Container,
-			Cmd:  "debc",
+			Cmd:  "debc" + changes,
+			Skip: cross || source,
+		}, {
+			Name:   n.Container,
+			Cmd:    "rm -rf " + naming.ContainerAutopkgtestDir,
+			AsRoot: true,
+		}, {
+			Name:    n.Container,
+			Cmd:     autopkgtest,
+			Network: true,
+			AsRoot:  true,
+			Skip:    !runTests,
 		}, {
 			Name: n.Container,
-			Cmd:  "lintian" + " " + lintianFlags,
-			Skip: noLintian,
+			Cmd:  lintianCmd,
+			Skip: testArgs.NoLintian,
 		},
 	}
 
-	for _, arg := range args {
-		err := dock.ContainerExec(arg)
-		if err != nil {
-			return log.Failed(err)
-		}
+	// Output of previous run must not be archived
+	err = os.Remove(n.LintianFile)
+	if err != nil && !os.IsNotExist(err) {
+		return log.Failed(err)
 	}
 
-	return log.Done()
-}
-
-// Archive function moves successful build to archive if files changed.
-func Archive(n *naming.Naming) error {
-	log.Info("Archiving build")
-
-	// Make needed directories
-	err := os.MkdirAll(n.ArchiveVersionDir, os.ModePerm)
+	buildLog, err := openBuildLog(n)
 	if err != nil {
 		return log.Failed(err)
 	}
+	defer buildLog.Close()
 
-	// Read files in build directory
-	files, err := ioutil.ReadDir(n.BuildDir)
+	err = execute(dock, buildLog, args...)
 	if err != nil {
 		return log.Failed(err)
 	}
 
-	log.Drop()
-
-	for _, f := range files {
-		// We don't need directories, only files
-		if f.IsDir() {
-			continue
-		}
-
-		log.ExtraInfo(f.Name())
-
-		sourcePath := filepath.Join(n.BuildDir, f.Name())
-		targetPath := filepath.Join(n.ArchiveVersionDir, f.Name())
-
-		sourceFile, err := os.Open(sourcePath)
-		if err != nil {
-			return log.Failed(err)
-		}
+	if testArgs.NoLintian {
+		return log.Done()
+	}
 
-		sourceBytes, err := ioutil.ReadAll(sourceFile)
-		if err != nil {
-			return log.Failed(err)
-		}
+	err = checkLintian(n, testArgs.FailOn)
+	if err != nil {
+		return log.Failed(err)
+	}
 
-		sourceStat, err := sourceFile.Stat()
-		if err != nil {
-			return log.Failed(err)
-		}
+	return log.Done()
+}
 
-		// Check if target file already exists
-		targetStat, _ := os.Stat(targetPath)
-		if targetStat != nil {
-			targetFile, err := os.Open(targetPath)
-			if err != nil {
-				return log.Failed(err)
-			}
+// checkLintian function prints summary of lintian tags
+// and checks them against tags of previously archived version.
+func checkLintian(n *naming.Naming, failOn string) error {
+	tags, err := lintian.ParseFile(n.LintianFile)
+	if err != nil {
+		return err
+	}
 
-			targetBytes, err := ioutil.ReadAll(targetFile)
-			if err != nil {
-				return log.Failed(err)
-			}
+	fmt.Fprint(log.Writer(), lintian.Summary(tags))
 
-			sourceChecksum := md5.Sum(sourceBytes)
-			targetChecksum := md5.Sum(targetBytes)
+	previous, err := previousVersion(n)
+	if err != nil {
+		return err
+	}
 
-			// Compare checksums of source and target files
-			//
-			// if equal then simply skip copying this file
-			if targetChecksum == sourceChecksum {
-				_ = log.Skipped()
-				continue
-			}
-		}
+	var previousTags []lintian.Tag
 
-		// Target file doesn't exist or checksums mismatched
-		err = ioutil.WriteFile(targetPath, sourceBytes, sourceStat.Mode())
+	if previous != "" {
+		previousTags, err = lintian.ParseFile(filepath.Join(n.ArchiveSourceDir, previous, filepath.Base(n.LintianFile)))
 		if err != nil {
-			return log.Failed(err)
+			return err
 		}
+	}
 
-		err = sourceFile.Close()
-		if err != nil {
-			return log.Failed(err)
-		}
+	return lintian.Check(tags, previousTags, failOn)
+}
 
-		_ = log.Done()
-	}
+// InstallArgs struct represents arguments
+// passed to Install().
+type InstallArgs struct {
+	// Enabled makes installation test run at all
+	Enabled bool
+	// AptProxy is used instead of apt cache directory, if set
+	AptProxy string
+	// Mode is the build mode packages were built in
+	Mode string
+	// Customization is applied to installation image too,
+	// except for custom template
+	Customization dockerfile.Customization
+}
 
-	log.Drop()
-	return log.Done()
+// snapshotIgnore lists paths not taken into account when looking
+// for files left over after purging packages
+var snapshotIgnore = []string{
+	"/proc",
+	"/sys",
+	"/dev",
+	"/run",
+	"/tmp",
+	"/var/cache",
+	"/var/lib/apt",
+	"/var/lib/dpkg",
+	"/var/log",
+	naming.ContainerBuildDir,
+	naming.ContainerPreviousDir,
 }
 
-// Stop function commands Docker Engine to stop container.
-func Stop(dock *docker.Docker, n *naming.Naming) error {
-	log.Info("Stopping container")
+// Install function tests installation, upgrade and removal of built packages
+// in fresh container made from parent image, like piuparts does.
+//
+// Container is made from minimal image built on top of parent image
+// for the same architecture, with extra Dockerfile snippet applied.
+//
+// Packages of previously archived version, if any, are installed first,
+// so the upgrade path is checked too. After purging, filesystem is compared
+// with its state from before the installation and leftover files fail the step.
+//
+// Cross-built packages can't be installed and source-only builds have no packages,
+// so the step is skipped for them.
+func Install(dock *docker.Docker, n *naming.Naming, installArgs InstallArgs) error {
+	log.Info("Testing installation")
 
-	isContainerStopped, err := dock.IsContainerStopped(n.Container)
-	if err != nil {
-		return log.Failed(err)
-	}
-	if isContainerStopped {
+	if !installArgs.Enabled || n.HostArch != "" || installArgs.Mode == ModeSource {
 		return log.Skipped()
 	}
 
-	err = dock.ContainerStop(n.Container)
+	labels, err := dock.ImageLabels(n.Image)
 	if err != nil {
 		return log.Failed(err)
 	}
 
-	return log.Done()
-}
-
-// Remove function commands Docker Engine to remove container.
-func Remove(dock *docker.Docker, n *naming.Naming) error {
-	log.Info("Removing container")
+	parent := labels[naming.LabelParentImage]
+	if parent == "" {
+		return log.Failed(fmt.Errorf("image %s lacks %s label, rebuild it", n.Image, naming.LabelParentImage))
+	}
 
-	isContainerCreated, err := dock.IsContainerCreated(n.Container)
+	dockerFile, err := dockerfile.ParseInstall(parent, installArgs.Customization)
 	if err != nil {
 		return log.Failed(err)
 	}
-	if !isContainerCreated {
-		return log.Skipped()
-	}
+
+	platform := ""
+	if n.Arch != "" {
+		platform, err = arch.Platform(n.Arch)
+		if err != nil {
+			return log.Failed(err)
+		}
+	}
+
+	previous, err := previousVersion(n)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	mounts := []mount.Mount{
+		{
+			Type:     mount.TypeBind,
+			Source:   n.BuildDir,
+			Target:   naming.ContainerBuildDir,
+			ReadOnly: true,
+		},
+	}
+
+	if previous != "" {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   filepath.Join(n.ArchiveSourceDir, previous),
+			Target:   naming.ContainerPreviousDir,
+			ReadOnly: true,
+		})
+	}
+
+	if installArgs.AptProxy == "" {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: n.CacheDir,
+			Target: naming.ContainerCacheDir,
+		})
+
+		cacheLock, err := lock.Acquire(n.CacheLock)
+		if err != nil {
+			return log.Failed(err)
+		}
+		defer cacheLock.Release()
+	}
+
+	for _, mnt := range mounts {
+		log.Debug("mount: " + mnt.Source + " -> " + mnt.Target)
+	}
+
+	// Leftover of interrupted run
+	isContainerCreated, err := dock.IsContainerCreated(n.InstallContainer)
+	if err != nil {
+		return log.Failed(err)
+	}
+	if isContainerCreated {
+		err = removeContainer(dock, n.InstallContainer)
+		if err != nil {
+			return log.Failed(err)
+		}
+	}
+
+	log.Drop()
+
+	// Mostly cached, so cheap after first time
+	err = dock.ImageBuild(docker.ImageBuildArgs{
+		Name:       n.InstallImage,
+		Dockerfile: dockerFile,
+		Platform:   platform,
+		HTTPProxy:  installArgs.AptProxy,
+		Output:     log.Writer(),
+	})
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	err = dock.ContainerCreate(docker.ContainerCreateArgs{
+		Mounts: mounts,
+		Image:  n.InstallImage,
+		Name:   n.InstallContainer,
+	})
+	if err != nil {
+		return log.Failed(err)
+	}
+	defer removeContainer(dock, n.InstallContainer)
+
+	err = dock.ContainerStart(n.InstallContainer)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	prune := make([]string, 0)
+	for _, path := range snapshotIgnore {
+		prune = append(prune, "-path "+path)
+	}
+
+	snapshot := fmt.Sprintf("find / -xdev \\( %s \\) -prune -o -print | sort > ", strings.Join(prune, " -o "))
+	packages := fmt.Sprintf("$(for deb in %s/*.deb; do dpkg-deb -f $deb Package; done)", naming.ContainerBuildDir)
+	leftovers := "comm -13 /tmp/before /tmp/after > /tmp/leftovers; " +
+		"if [ -s /tmp/leftovers ]; then echo 'Files left after purge:'; cat /tmp/leftovers; exit 1; fi"
+
+	proxy := "true"
+	if installArgs.AptProxy != "" {
+		proxy = fmt.Sprintf("echo 'Acquire::http::Proxy \"%s\";' > /etc/apt/apt.conf.d/00proxy", installArgs.AptProxy)
+	}
+
+	args := []docker.ContainerExecArgs{
+		{
+			Cmd: proxy,
+		}, {
+			Cmd:     "apt-get update",
+			Network: true,
+		}, {
+			Cmd: snapshot + "/tmp/before",
+		}, {
+			Cmd:     "apt-get install -y " + naming.ContainerPreviousDir + "/*.deb",
+			Network: true,
+			Skip:    previous == "",
+		}, {
+			Cmd:     "apt-get install -y " + naming.ContainerBuildDir + "/*.deb",
+			Network: true,
+		}, {
+			Cmd: "apt-get purge -y --autoremove " + packages,
+		}, {
+			Cmd: snapshot + "/tmp/after",
+		}, {
+			Cmd: leftovers,
+		},
+	}
+
+	for i := range args {
+		args[i].Name = n.InstallContainer
+		args[i].AsRoot = true
+	}
+
+	buildLog, err := openBuildLog(n)
+	if err != nil {
+		return log.Failed(err)
+	}
+	defer buildLog.Close()
+
+	err = execute(dock, buildLog, args...)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	return log.Done()
+}
+
+// Archive function moves successful build to archive if files changed.
+//
+// Only .changes file produced in given build mode and files listed in it
+// are archived, other files in build directory may be left by previous builds.
+// Build log (.build file), lintian output and autopkgtest results
+// are archived along with them.
+//
+// Files expected to be produced in given build mode must be present,
+// otherwise nothing is archived.
+//
+// Afterwards it regenerates local repository index of archive target directory.
+func Archive(n *naming.Naming, mode string) error {
+	log.Info("Archiving build")
+
+	err := CheckOutputs(n, mode)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	archiveLock, err := lock.Acquire(n.ArchiveLock)
+	if err != nil {
+		return log.Failed(err)
+	}
+	defer archiveLock.Release()
+
+	// Make needed directories
+	err = os.MkdirAll(n.ArchiveVersionDir, os.ModePerm)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	changes := changesFile(n, mode)
+
+	names, err := listedFiles(changes)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	names = append(names, filepath.Base(changes))
+
+	// Those are not produced by every build
+	for _, path := range []string{n.BuildLogFile, n.LintianFile} {
+		info, _ := os.Stat(path)
+		if info != nil {
+			names = append(names, filepath.Base(path))
+		}
+	}
+
+	log.Drop()
+
+	for _, name := range names {
+		log.ExtraInfo(name)
+
+		sourcePath := filepath.Join(n.BuildDir, name)
+		targetPath := filepath.Join(n.ArchiveVersionDir, name)
+
+		sourceFile, err := os.Open(sourcePath)
+		if err != nil {
+			return log.Failed(err)
+		}
+
+		sourceBytes, err := ioutil.ReadAll(sourceFile)
+		if err != nil {
+			return log.Failed(err)
+		}
+
+		sourceStat, err := sourceFile.Stat()
+		if err != nil {
+			return log.Failed(err)
+		}
+
+		// Check if target file already exists
+		targetStat, _ := os.Stat(targetPath)
+		if targetStat != nil {
+			targetFile, err := os.Open(targetPath)
+			if err != nil {
+				return log.Failed(err)
+			}
+
+			targetBytes, err := ioutil.ReadAll(targetFile)
+			if err != nil {
+				return log.Failed(err)
+			}
+
+			sourceChecksum := md5.Sum(sourceBytes)
+			targetChecksum := md5.Sum(targetBytes)
+
+			// Compare checksums of source and target files
+			//
+			// if equal then simply skip copying this file
+			if targetChecksum == sourceChecksum {
+				_ = log.Skipped()
+				continue
+			}
+		}
+
+		// Target file doesn't exist or checksums mismatched
+		err = ioutil.WriteFile(targetPath, sourceBytes, sourceStat.Mode())
+		if err != nil {
+			return log.Failed(err)
+		}
+
+		err = sourceFile.Close()
+		if err != nil {
+			return log.Failed(err)
+		}
+
+		_ = log.Done()
+	}
+
+	// Results of previous autopkgtest run get replaced
+	info, _ := os.Stat(n.AutopkgtestDir)
+	if info != nil && info.IsDir() {
+		log.ExtraInfo(filepath.Base(n.AutopkgtestDir))
+
+		targetDir := filepath.Join(n.ArchiveVersionDir, filepath.Base(n.AutopkgtestDir))
+
+		err = os.RemoveAll(targetDir)
+		if err != nil {
+			return log.Failed(err)
+		}
+
+		err = copyResults(n.AutopkgtestDir, targetDir)
+		if err != nil {
+			return log.Failed(err)
+		}
+
+		_ = log.Done()
+	}
+
+	log.ExtraInfo("repository index")
+
+	err = repo.Generate(n.ArchiveTargetDir)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	_ = log.Done()
+
+	log.Drop()
+	return log.Done()
+}
+
+// Sign function signs archived .changes file produced in given build mode
+// along with .dsc and .buildinfo files listed in it, using given OpenPGP secret key.
+//
+// Local repository index of archive target directory is regenerated
+// and signed too.
+func Sign(n *naming.Naming, mode, key, passphrase string) error {
+	log.Info("Signing build")
+
+	if key == "" {
+		return log.Skipped()
+	}
+
+	signer, err := sign.Load(key, passphrase)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	archiveLock, err := lock.Acquire(n.ArchiveLock)
+	if err != nil {
+		return log.Failed(err)
+	}
+	defer archiveLock.Release()
+
+	// Archive may hold .changes of other builds of this version
+	changes := filepath.Join(n.ArchiveVersionDir, filepath.Base(changesFile(n, mode)))
+
+	err = signer.SignChanges(changes)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	// Checksums of signed .dsc files changed
+	err = repo.Generate(n.ArchiveTargetDir)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	err = signer.SignRepo(n.ArchiveTargetDir)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	return log.Done()
+}
+
+// Stop function commands Docker Engine to stop container.
+func Stop(dock *docker.Docker, n *naming.Naming) error {
+	log.Info("Stopping container")
+
+	isContainerStopped, err := dock.IsContainerStopped(n.Container)
+	if err != nil {
+		return log.Failed(err)
+	}
+	if isContainerStopped {
+		return log.Skipped()
+	}
+
+	err = dock.ContainerStop(n.Container)
+	if err != nil {
+		return log.Failed(err)
+	}
+
+	return log.Done()
+}
+
+// Remove function commands Docker Engine to remove container.
+func Remove(dock *docker.Docker, n *naming.Naming) error {
+	log.Info("Removing container")
+
+	isContainerCreated, err := dock.IsContainerCreated(n.Container)
+	if err != nil {
+		return log.Failed(err)
+	}
+	if !isContainerCreated {
+		return log.Skipped()
+	}
 
 	err = dock.ContainerRemove(n.Container)
 	if err != nil {
@@ -522,3 +1241,339 @@ func ShellOptional(dock *docker.Docker, n *naming.Naming) error {
 
 	return log.Done()
 }
+
+// Step struct represents a single named step of the pipeline.
+type Step struct {
+	Name string
+	Run  func() error
+}
+
+// execute function runs given commands in container one by one,
+// printing them in verbose mode and passing their output to log.
+//
+// Commands and their output are appended to build log too.
+func execute(dock *docker.Docker, buildLog io.Writer, args ...docker.ContainerExecArgs) error {
+	for _, arg := range args {
+		if arg.Skip {
+			continue
+		}
+
+		log.Verbose(arg.Cmd)
+		fmt.Fprintf(buildLog, "+ %s\n", arg.Cmd)
+		arg.Output = io.MultiWriter(log.Writer(), buildLog)
+
+		err := dock.ContainerExec(arg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckOutputs function checks if build in given mode produced
+// .changes file and all files listed in it are present in build directory,
+// including at least one of every kind expected in that mode.
+//
+// Other files in build directory, possibly left by previous builds,
+// are not taken into account.
+func CheckOutputs(n *naming.Naming, mode string) error {
+	extensions, ok := modeOutputs[mode]
+	if !ok {
+		return fmt.Errorf("unknown build mode: %s", mode)
+	}
+
+	changes := changesFile(n, mode)
+
+	listed, err := listedFiles(changes)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("build didn't produce %s", filepath.Base(changes))
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, name := range listed {
+		info, _ := os.Stat(filepath.Join(n.BuildDir, name))
+		if info == nil {
+			return fmt.Errorf("%s lists %s, which is missing", filepath.Base(changes), name)
+		}
+	}
+
+	missing := make([]string, 0)
+
+	for _, extension := range extensions {
+		found := false
+		for _, name := range listed {
+			if strings.HasSuffix(name, extension) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, extension)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("build didn't produce any %s files", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// listedFiles function returns names of files listed in given .changes file.
+func listedFiles(changes string) ([]string, error) {
+	data, err := sign.ReadUnsigned(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	paragraphs, err := control.ParseBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(paragraphs) != 1 {
+		return nil, fmt.Errorf("%s: malformed changes file", changes)
+	}
+
+	listed := make([]string, 0)
+
+	for _, line := range paragraphs[0].Lines("Files") {
+		fields := strings.Fields(line)
+		listed = append(listed, fields[len(fields)-1])
+	}
+
+	return listed, nil
+}
+
+// changesFile function returns path of .changes file produced by build in given mode.
+//
+// In default mode it's not known what was built, so the most recent
+// of possible .changes files is picked.
+func changesFile(n *naming.Naming, mode string) string {
+	switch mode {
+	case ModeSource:
+		return n.SourceChangesFile
+	case ModeBinaryIndep:
+		return n.IndepChangesFile
+	case ModeFull, ModeBinaryArch:
+		return n.ChangesFile
+	}
+
+	var newest os.FileInfo
+	changes := n.ChangesFile
+
+	for _, path := range []string{n.ChangesFile, n.IndepChangesFile, n.SourceChangesFile} {
+		info, _ := os.Stat(path)
+		if info != nil && (newest == nil || info.ModTime().After(newest.ModTime())) {
+			newest = info
+			changes = path
+		}
+	}
+
+	return changes
+}
+
+// hasAutopkgtests function checks if source in given directory
+// declares any autopkgtests, either explicitly or via Testsuite field.
+func hasAutopkgtests(sourceDir string) (bool, error) {
+	info, _ := os.Stat(filepath.Join(sourceDir, "debian", "tests", "control"))
+	if info != nil {
+		return true, nil
+	}
+
+	paragraphs, err := control.ParseFile(filepath.Join(sourceDir, "debian", "control"))
+	if err != nil {
+		return false, err
+	}
+
+	return len(paragraphs) > 0 && paragraphs[0].Get("Testsuite") != "", nil
+}
+
+// copyResults function copies test results directory tree.
+//
+// Binary packages used by tests are left out, not to be
+// indexed into repository twice.
+func copyResults(sourceDir, targetDir string) error {
+	return filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(targetDir, rel)
+
+		if info.IsDir() {
+			if rel == "binaries" {
+				return filepath.SkipDir
+			}
+
+			return os.MkdirAll(target, os.ModePerm)
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(target, data, info.Mode())
+	})
+}
+
+// previousVersion function returns the highest archived version
+// of source lower than the one being built, or empty string if there is none.
+func previousVersion(n *naming.Naming) (string, error) {
+	current, err := version.Parse(n.Version)
+	if err != nil {
+		return "", err
+	}
+
+	files, err := ioutil.ReadDir(n.ArchiveSourceDir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	previous := ""
+	var highest version.Version
+
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+
+		v, err := version.Parse(f.Name())
+		if err != nil {
+			continue
+		}
+
+		if version.Compare(v, current) >= 0 {
+			continue
+		}
+
+		if previous == "" || version.Compare(v, highest) > 0 {
+			previous = f.Name()
+			highest = v
+		}
+	}
+
+	return previous, nil
+}
+
+// removeContainer function stops and removes container.
+func removeContainer(dock *docker.Docker, name string) error {
+	isContainerStopped, err := dock.IsContainerStopped(name)
+	if err != nil {
+		return err
+	}
+	if !isContainerStopped {
+		err = dock.ContainerStop(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return dock.ContainerRemove(name)
+}
+
+// openedBuildLogs holds paths of build logs already written during this run
+var openedBuildLogs = make(map[string]bool)
+
+// openBuildLog function opens build log for appending.
+//
+// Log left by previous run is truncated by whichever step
+// writes to it first, as some steps could be skipped.
+func openBuildLog(n *naming.Naming) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !openedBuildLogs[n.BuildLogFile] {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(n.BuildLogFile, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	openedBuildLogs[n.BuildLogFile] = true
+
+	return file, nil
+}
+
+// Select function filters given steps according to passed criteria.
+//
+// Steps are first limited to range between from and until (inclusive),
+// then if only is not empty, just the listed ones are kept,
+// at last steps listed in skip are removed.
+//
+// Empty from and until mean first and last step respectively.
+func Select(steps []Step, only, skip []string, from, until string) ([]Step, error) {
+	index := make(map[string]int)
+	for i, step := range steps {
+		index[step.Name] = i
+	}
+
+	names := append(append([]string{}, only...), skip...)
+	if from != "" {
+		names = append(names, from)
+	}
+	if until != "" {
+		names = append(names, until)
+	}
+
+	for _, name := range names {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("unknown step: %s", name)
+		}
+	}
+
+	first := 0
+	if from != "" {
+		first = index[from]
+	}
+
+	last := len(steps) - 1
+	if until != "" {
+		last = index[until]
+	}
+
+	if first > last {
+		return nil, fmt.Errorf("step %s comes after %s", from, until)
+	}
+
+	selected := make([]Step, 0)
+	for _, step := range steps[first : last+1] {
+		if len(only) > 0 && !contains(only, step.Name) {
+			continue
+		}
+
+		if contains(skip, step.Name) {
+			continue
+		}
+
+		selected = append(selected, step)
+	}
+
+	return selected, nil
+}
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,185 @@
+package steps_test
+
+import (
+	"github.com/dawidd6/deber/pkg/naming"
+	"github.com/dawidd6/deber/pkg/steps"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var pipeline = []steps.Step{
+	{Name: "build"},
+	{Name: "create"},
+	{Name: "start"},
+	{Name: "depends"},
+	{Name: "package"},
+	{Name: "test"},
+	{Name: "archive"},
+}
+
+func names(list []steps.Step) []string {
+	result := make([]string, 0)
+	for _, step := range list {
+		result = append(result, step.Name)
+	}
+
+	return result
+}
+
+func TestSelectAll(t *testing.T) {
+	selected, err := steps.Select(pipeline, nil, nil, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, names(pipeline), names(selected))
+}
+
+func TestSelectRange(t *testing.T) {
+	selected, err := steps.Select(pipeline, nil, []string{"test"}, "package", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"package", "archive"}, names(selected))
+
+	selected, err = steps.Select(pipeline, nil, nil, "", "depends")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"build", "create", "start", "depends"}, names(selected))
+}
+
+func TestSelectOnly(t *testing.T) {
+	selected, err := steps.Select(pipeline, []string{"archive", "build"}, nil, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"build", "archive"}, names(selected))
+}
+
+func TestSelectInvalid(t *testing.T) {
+	_, err := steps.Select(pipeline, nil, []string{"lint"}, "", "")
+	assert.Error(t, err)
+
+	_, err = steps.Select(pipeline, nil, nil, "test", "create")
+	assert.Error(t, err)
+}
+
+const sourceChanges = `Format: 1.8
+Source: pkg
+Version: 1.0-1
+Files:
+ 0123456789abcdef0123456789abcdef 100 misc optional pkg_1.0-1.dsc
+ 0123456789abcdef0123456789abcdef 100 misc optional pkg_1.0-1_source.buildinfo
+`
+
+func TestCheckOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deber")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n := naming.New(naming.Args{
+		Prefix:       "deber",
+		Source:       "pkg",
+		Version:      "1.0-1",
+		Upstream:     "1.0",
+		Target:       "bookworm",
+		Arch:         "arm64",
+		BuildBaseDir: dir,
+	})
+
+	assert.NoError(t, os.MkdirAll(n.BuildDir, os.ModePerm))
+
+	files := map[string]string{
+		"pkg_1.0-1.dsc":              "",
+		"pkg_1.0-1_source.buildinfo": "",
+		"pkg_1.0-1_source.changes":   sourceChanges,
+	}
+
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(n.BuildDir, name), []byte(content), 0644)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, steps.CheckOutputs(n, steps.ModeDefault))
+	assert.NoError(t, steps.CheckOutputs(n, steps.ModeSource))
+	assert.Error(t, steps.CheckOutputs(n, "everything"))
+}
+
+func TestCheckOutputsStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deber")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n := naming.New(naming.Args{
+		Prefix:       "deber",
+		Source:       "pkg",
+		Version:      "1.0-1",
+		Upstream:     "1.0",
+		Target:       "bookworm",
+		Arch:         "arm64",
+		BuildBaseDir: dir,
+	})
+
+	assert.NoError(t, os.MkdirAll(n.BuildDir, os.ModePerm))
+
+	// Left by previous builds, but no .changes of full build
+	for _, name := range []string{"pkg_1.0-1.dsc", "pkg_1.0-1_arm64.deb", "pkg_1.0-1_arm64.buildinfo"} {
+		err = ioutil.WriteFile(filepath.Join(n.BuildDir, name), nil, 0644)
+		assert.NoError(t, err)
+	}
+
+	assert.EqualError(t, steps.CheckOutputs(n, steps.ModeFull), "build didn't produce pkg_1.0-1_arm64.changes")
+
+	// Source-only .changes lists buildinfo that is missing
+	err = ioutil.WriteFile(n.SourceChangesFile, []byte(sourceChanges), 0644)
+	assert.NoError(t, err)
+
+	assert.EqualError(t, steps.CheckOutputs(n, steps.ModeSource), "pkg_1.0-1_source.changes lists pkg_1.0-1_source.buildinfo, which is missing")
+
+	// Listed files are there, but not a single binary package
+	err = ioutil.WriteFile(n.ChangesFile, []byte(sourceChanges), 0644)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(n.BuildDir, "pkg_1.0-1_source.buildinfo"), nil, 0644)
+	assert.NoError(t, err)
+
+	assert.EqualError(t, steps.CheckOutputs(n, steps.ModeFull), "build didn't produce any .deb files")
+}
+
+func TestArchiveStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deber")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n := naming.New(naming.Args{
+		Prefix:         "deber",
+		Source:         "pkg",
+		Version:        "1.0-1",
+		Upstream:       "1.0",
+		Target:         "bookworm",
+		Arch:           "arm64",
+		BuildBaseDir:   filepath.Join(dir, "build"),
+		ArchiveBaseDir: filepath.Join(dir, "archive"),
+	})
+
+	assert.NoError(t, os.MkdirAll(n.BuildDir, os.ModePerm))
+
+	// Full build was made before the source-only one
+	files := map[string]string{
+		"pkg_1.0-1.dsc":              "Format: 3.0 (quilt)\nSource: pkg\nVersion: 1.0-1\n",
+		"pkg_1.0-1_source.buildinfo": "",
+		"pkg_1.0-1_source.changes":   sourceChanges,
+		"pkg_1.0-1_arm64.deb":        "",
+		"pkg_1.0-1_arm64.changes":    sourceChanges,
+		"lintian.txt":                "",
+	}
+
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(n.BuildDir, name), []byte(content), 0644)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, steps.Archive(n, steps.ModeSource))
+
+	for _, name := range []string{"pkg_1.0-1.dsc", "pkg_1.0-1_source.buildinfo", "pkg_1.0-1_source.changes", "lintian.txt"} {
+		assert.FileExists(t, filepath.Join(n.ArchiveVersionDir, name))
+	}
+
+	for _, name := range []string{"pkg_1.0-1_arm64.deb", "pkg_1.0-1_arm64.changes"} {
+		assert.NoFileExists(t, filepath.Join(n.ArchiveVersionDir, name))
+	}
+}
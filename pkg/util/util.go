@@ -1,7 +1,12 @@
 // Package util includes useful helper functions
 package util
 
-import "github.com/docker/docker/api/types/mount"
+import (
+	"github.com/docker/docker/api/types/mount"
+	"io"
+	"os"
+	"path/filepath"
+)
 
 // CompareMounts function simply compares if given mounts are equal
 func CompareMounts(a, b []mount.Mount) bool {
@@ -25,3 +30,74 @@ func CompareMounts(a, b []mount.Mount) bool {
 
 	return false
 }
+
+// LinkOrCopy function hard links file to destination,
+// falling back to copying it, e.g. across filesystems.
+func LinkOrCopy(src, dst string) error {
+	err := os.Link(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	return CopyFile(src, dst)
+}
+
+// CopyFile function copies regular file, preserving its mode.
+func CopyFile(src, dst string) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	target, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(target, source)
+	if err != nil {
+		target.Close()
+		return err
+	}
+
+	return target.Close()
+}
+
+// CopyTree function recursively copies directory,
+// preserving modes and symbolic links.
+func CopyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return CopyFile(path, target)
+		}
+
+		return nil
+	})
+}
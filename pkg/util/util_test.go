@@ -4,6 +4,9 @@ import (
 	"github.com/dawidd6/deber/pkg/util"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -129,3 +132,51 @@ func TestCompareMountsDifferentSizes(t *testing.T) {
 	equal := util.CompareMounts(a, b)
 	assert.True(t, !equal)
 }
+
+func TestCopyTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deber")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "debian"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "debian", "rules"), []byte("#!/usr/bin/make -f\n"), 0755))
+	assert.NoError(t, os.Symlink("debian/rules", filepath.Join(src, "rules")))
+
+	assert.NoError(t, util.CopyTree(src, dst))
+
+	info, err := os.Stat(filepath.Join(dst, "debian", "rules"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode())
+
+	link, err := os.Readlink(filepath.Join(dst, "rules"))
+	assert.NoError(t, err)
+	assert.Equal(t, "debian/rules", link)
+
+	// Copy is independent of original
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dst, "debian", "rules"), nil, 0755))
+	data, err := ioutil.ReadFile(filepath.Join(src, "debian", "rules"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, data)
+}
+
+func TestLinkOrCopy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deber")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "pkg_1.0.orig.tar.gz")
+	dst := filepath.Join(dir, "build.tar.gz")
+
+	assert.NoError(t, ioutil.WriteFile(src, []byte("tarball"), 0644))
+	assert.NoError(t, util.LinkOrCopy(src, dst))
+
+	_, err = os.Stat(src)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "tarball", string(data))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/dawidd6/deber/pkg/lock"
+	"github.com/dawidd6/deber/pkg/steps"
+	"github.com/spf13/cobra"
+)
+
+func shellCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "shell",
+		Short: "Launch interactive shell in container of package in current directory",
+		Args:  cobra.NoArgs,
+		RunE:  runShell,
+	}
+}
+
+func runShell(cmd *cobra.Command, args []string) error {
+	dock, n, err := setup(sourceDir(args))
+	if err != nil {
+		return err
+	}
+
+	// Other process may be using the same container
+	containerLock, err := lock.Acquire(n.ContainerLock)
+	if err != nil {
+		return err
+	}
+	defer containerLock.Release()
+
+	err = steps.Build(dock, n, buildArgs())
+	if err != nil {
+		return err
+	}
+
+	err = steps.Create(dock, n, *packages, *aptProxy)
+	if err != nil {
+		return err
+	}
+
+	err = steps.Start(dock, n)
+	if err != nil {
+		return err
+	}
+
+	return steps.ShellOptional(dock, n)
+}